@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Struct for a subcommand like "webnotes add".
+// The command only accepts the flags listed here, which are described in flagHelp.
+type command struct {
+	help        string
+	boolFlags   []string
+	stringFlags []string
+}
+
+// arguments of the commands that take one, like "webnotes retag golang=go"
+// In the older form the argument is the value of the command's flag, like --retag golang=go.
+var commandArgs = map[string]string{
+	"merge_tags": "<tags>=<tag>",
+	"retag":      "<old>=<new>",
+}
+
+// flag groups shared by commands
+var (
+	fileFlags        = []string{"dir", "file"}
+	fetchBoolFlags   = []string{"cache_only", "ignore_robots"}
+	fetchStringFlags = []string{"cache_dir", "cache_ttl", "cookie_file", "headers_file", "host_interval", "max_body_size",
+		"own_hosts", "proxy", "timeout", "user_agent"}
+	// flags every command accepts
+	globalStringFlags = []string{"root"}
+	// flags of commands that print records
+	outputStringFlags = []string{"format", "template"}
+)
+
+// selectorFlags returns the --e and --m webnote selector flags.
+func selectorFlags() []string {
+	flags := []string{}
+	for _, sm := range sectionMatchers {
+		flags = append(flags, "e"+sm, "m"+sm)
+	}
+	return flags
+}
+
+// valueFlags returns the --v flags for the values provided.
+func valueFlags(values ...string) []string {
+	flags := []string{}
+	for _, value := range values {
+		flags = append(flags, "v"+value)
+	}
+	return flags
+}
+
+// join joins groups of flags.
+func join(groups ...[]string) []string {
+	flags := []string{}
+	for _, group := range groups {
+		flags = append(flags, group...)
+	}
+	return flags
+}
+
+// fill and set accept the same flags
+var (
+	fillBoolFlags   = join(boolSectionMatchers, []string{"date"}, getValueSpecifiers, fetchBoolFlags)
+	fillStringFlags = join(fileFlags, selectorFlags(), valueFlags(valueSpecifiers...), valueFlags("body", "tags"),
+		fetchStringFlags, []string{"warc_dir"})
+)
+
+var commands = map[string]*command{
+	"add": {"adds a webnote",
+		join([]string{"date"}, getValueSpecifiers, fetchBoolFlags),
+		join([]string{"out_file"}, valueFlags(stringValueSpecifiers...), fetchStringFlags, []string{"warc_dir"})},
+	"append": {"appends to webnotes' bodies",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags(), valueFlags("body"))},
+	"archive": {"archives webnotes' urls to WARC files",
+		join(boolSectionMatchers, fetchBoolFlags),
+		join(fileFlags, selectorFlags(), fetchStringFlags, []string{"warc_dir"})},
+	"clean_tags": {"changes invalid tags in webnotes to valid ones and removes empty tags",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags())},
+	"clear": {"clears webnotes fields and/or bodies",
+		join(boolSectionMatchers, boolValueSpecifiers),
+		join(fileFlags, selectorFlags())},
+	"combine": {"combines webnotes with the same note string or url",
+		nil,
+		fileFlags},
+	"copy": {"copies webnotes to a different file",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags(), []string{"out_file"})},
+	"delete": {"deletes webnotes",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags())},
+	"duplicates": {"prints duplicate webnotes",
+		join(boolSectionMatchers, []string{"locations"}),
+		join(fileFlags, selectorFlags(), outputStringFlags)},
+	"edit": {"edits webnotes in $EDITOR and saves the changes back to their files",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags())},
+	"fill": {"sets webnotes fields and/or bodies if not already set",
+		fillBoolFlags,
+		fillStringFlags},
+	"format": {"loads webnote files and saves them standard formating",
+		nil,
+		fileFlags},
+	"head": {"does an HTTP head on webnotes",
+		join(boolSectionMatchers, fetchBoolFlags),
+		join(fileFlags, selectorFlags(), fetchStringFlags)},
+	"http": {"runs a webserver so webnotes can be viewed in browser",
+		nil,
+		[]string{"http_address", "out_file", "threshold", "warc_dir"}},
+	"index": {"builds the index for a set of webnotes",
+		nil,
+		nil},
+	"lint": {"prints every problem found in webnote files",
+		[]string{"fix"},
+		join(fileFlags, []string{"lint_rules"}, outputStringFlags)},
+	"matches": {"prints webnotes that match comand line selectors",
+		join(boolSectionMatchers, []string{"locations"}),
+		join(fileFlags, selectorFlags(), outputStringFlags)},
+	"merge": {"merges duplicate webnotes across files into one of them and fixes links to moved notes",
+		nil,
+		join(fileFlags, []string{"home", "priority"})},
+	"merge_tags": {"replaces tags with one tag, like js,javascript=javascript",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags())},
+	"move": {"moves webnotes to a different file",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags(), []string{"out_file"})},
+	"normalize_tags": {"changes tag aliases in webnotes to the tags of the tag vocabulary",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags())},
+	"normalize_urls": {"rewrites webnotes' urls without tracking parameters, fragments and default ports",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags())},
+	"retag": {"renames a tag, like golang=go",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags())},
+	"set": {"sets webnotes fields and/or bodies",
+		fillBoolFlags,
+		fillStringFlags},
+	"similar": {"prints clusters of webnotes whose titles and bodies are nearly the same",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags(), []string{"threshold"}, outputStringFlags)},
+	"sort": {"sorts the sections in webnote files",
+		nil,
+		fileFlags},
+	"stats": {"prints counts of webnotes per tag, host, author, file and year and of tags used together",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags(), outputStringFlags)},
+	"suggest_tags": {"prints or adds tags suggested by the tags of similar webnotes",
+		join(boolSectionMatchers, []string{"apply"}),
+		join(fileFlags, selectorFlags(), []string{"threshold"}, outputStringFlags)},
+	"tag": {"puts a tag on webnotes",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags(), valueFlags("tags"))},
+	"tui": {"browses and curates webnotes in a terminal user interface",
+		fetchBoolFlags,
+		join(fileFlags, fetchStringFlags)},
+	"untag": {"removes tags from webnotes, like --vtags old,unused",
+		boolSectionMatchers,
+		join(fileFlags, selectorFlags(), valueFlags("tags"))},
+}
+
+// flagHelp describes each flag as "<value> : description" or ": description" for bool flags.
+var flagHelp = map[string]string{
+	"all":           ": all fields and body",
+	"apply":         ": adds the suggested tags instead of printing them",
+	"cache_dir":     "<directory> : caches responses in the directory",
+	"cache_only":    ": only uses cached responses, never the network",
+	"cache_ttl":     "<duration> : how long cached responses are used before revalidating, like 24h",
+	"cookie_file":   "<file> : cookies in Netscape cookies.txt format",
+	"date":          ": date field",
+	"dir":           "<directory> : only webnote files in the directory",
+	"file":          "<file> : only the webnote file",
+	"fix":           ": corrects the problems that are safe to correct",
+	"format":        "<format> : prints csv, json, jsonl, template or tsv instead of text",
+	"headers_file":  "<file> : lines of \"<host> <name>: <value>\" headers to send",
+	"host_interval": "<duration> : least time between requests to a host, like 1s",
+	"home":          "<home> : oldest, tags or priority, chooses the webnote duplicates are merged into",
+	"http_address":  "<address> : address to listen on, defaults to :8080",
+	"ignore_robots": ": fetches urls that robots.txt disallows",
+	"images":        ": grab images from url and write as markdown",
+	"links":         ": grab links from url and write as markdown",
+	"lint_rules":    "<rules> : comma separated rules to check, like default,-unknown-field,empty-body",
+	"locations":     ": prints the file and line of each webnote, like Links.wn:12",
+	"max_body_size": "<bytes> : largest response body to read",
+	"note":          ": matches notes",
+	"out_file":      "<file> : file output is written to",
+	"own_hosts":     "<hosts> : comma separated hosts that are not checked against robots.txt or rate limited",
+	"p":             ": grab text inside of <p></p> tags",
+	"priority":      "<files> : comma separated files, duplicates are merged into the first one listed",
+	"proxy":         "<url> : proxy to use instead of the environment's proxy",
+	"root":          "<directory> : the workspace root",
+	"template":      "<template> : Go text/template printed for each record, like {{.URL}}\\t{{.Title}}",
+	"text":          ": grab all text from url",
+	"threshold":     "<number> : from 0 to 1, how similar webnotes must be or how confident suggestions must be",
+	"timeout":       "<duration> : time limit for requests, like 30s",
+	"url":           ": matches urls",
+	"user_agent":    "<string> : User-Agent header to send",
+	"warc_dir":      "<directory> : directory WARC files are written to and read from",
+}
+
+// describeFlag returns the help for a flag.
+func describeFlag(name string) string {
+	if help, ok := flagHelp[name]; ok {
+		return help
+	}
+	if strings.HasPrefix(name, "v") && slices.Contains(stringValueSpecifiers, name[1:]) {
+		return fmt.Sprintf("<%s> : value for the %s", name[1:], name[1:])
+	}
+	if slices.Contains(boolValueSpecifiers, name) {
+		return fmt.Sprintf(": %s field", name)
+	}
+	if len(name) > 1 && slices.Contains(sectionMatchers, name[1:]) {
+		if name[0] == 'e' {
+			return fmt.Sprintf("<string> : %s equals", name[1:])
+		}
+		return fmt.Sprintf("<pattern> : %s matches", name[1:])
+	}
+	return ""
+}
+
+// commandUsage prints the help for a command.
+func commandUsage(name string) {
+	cmd := commands[name]
+	fmt.Printf("Usage of webnotes %s:\n", name)
+	fmt.Printf("  %s\n", cmd.help)
+	if arg, ok := commandArgs[name]; ok {
+		fmt.Printf("  webnotes %s %s [flags]\n", name, arg)
+	}
+	fmt.Println(" flags:")
+	flags := join(cmd.boolFlags, cmd.stringFlags, globalStringFlags)
+	sort.Strings(flags)
+	for _, f := range flags {
+		fmt.Printf("  --%s %s\n", f, describeFlag(f))
+	}
+}
+
+// commandsUsage prints the list of commands.
+func commandsUsage() {
+	fmt.Println("Usage of webnotes:")
+	fmt.Println("  webnotes <command> [flags]")
+	fmt.Println("  webnotes help <command> : prints the flags of a command")
+	fmt.Println(" commands:")
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %s : %s\n", name, commands[name].help)
+	}
+	fmt.Println(" The older form, like webnotes --add, also works. See webnotes --help.")
+}
+
+// errHelp is returned by parseCommand when help was asked for and printed.
+var errHelp = errors.New("help")
+
+// errUsage is returned by parseCommand when the arguments are invalid and usage was printed.
+var errUsage = errors.New("usage")
+
+// parseCommand parses the arguments of a subcommand like "webnotes add --vnote a".
+// Only the flags of the command, and its argument if it takes one, are accepted.
+// Returns (*options, main_function, nil) on success.
+// Returns (nil, nil, errHelp) if help was asked for.
+// Returns (nil, nil, errUsage) if the flags are invalid.
+// Returns (nil, nil, error) if the command is unknown.
+func parseCommand(args []string) (*options, func(*options) error, error) {
+	name := args[0]
+	if name == "help" {
+		if len(args) > 1 {
+			if _, ok := commands[args[1]]; ok {
+				commandUsage(args[1])
+				return nil, nil, errHelp
+			}
+		}
+		commandsUsage()
+		return nil, nil, errHelp
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		return nil, nil, errors.New(fmt.Sprintf("Unknown command: %s", name))
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() { commandUsage(name) }
+	b := map[string]*bool{}
+	s := map[string]*string{}
+	for _, f := range cmd.boolFlags {
+		b[f] = fs.Bool(f, false, "")
+	}
+	for _, f := range join(cmd.stringFlags, globalStringFlags) {
+		s[f] = fs.String(f, "", "")
+	}
+	// the argument of a command that takes one can come before or after the flags
+	rest := args[1:]
+	arg := ""
+	_, takesArg := commandArgs[name]
+	if takesArg && len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		arg, rest = rest[0], rest[1:]
+	}
+	if err := fs.Parse(rest); err == flag.ErrHelp {
+		return nil, nil, errHelp
+	} else if err != nil {
+		return nil, nil, errUsage
+	}
+	unexpected := fs.Args()
+	if takesArg && arg == "" && len(unexpected) > 0 {
+		arg, unexpected = unexpected[0], unexpected[1:]
+	}
+	if len(unexpected) > 0 {
+		fmt.Printf("Unexpected arguments: %s\n", strings.Join(unexpected, " "))
+		commandUsage(name)
+		return nil, nil, errUsage
+	}
+	if takesArg {
+		s[name] = &arg
+	}
+	o := newOptions(b, s)
+	return o, mainFuncs[name], nil
+}
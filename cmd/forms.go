@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/greglange/webnotes/pkg/webnotes"
+)
+
+// Struct for the values of the add and edit forms of the webserver.
+// id is the ID of the webnote being edited, it is empty when adding one.
+type sectionForm struct {
+	file  string
+	id    string
+	note  string
+	url   string
+	title string
+	tags  string
+	body  string
+}
+
+// newSectionForm returns the form with the values submitted to it.
+func newSectionForm(values url.Values) *sectionForm {
+	return &sectionForm{
+		file:  values.Get("file"),
+		id:    values.Get("id"),
+		note:  values.Get("note"),
+		url:   values.Get("url"),
+		title: values.Get("title"),
+		tags:  values.Get("tags"),
+		body:  strings.ReplaceAll(values.Get("body"), "\r\n", "\n"),
+	}
+}
+
+// values returns the form's values, to link to the form with them filled in.
+func (f *sectionForm) values() url.Values {
+	values := url.Values{}
+	for name, value := range map[string]string{
+		"file": f.file, "id": f.id, "note": f.note, "url": f.url, "title": f.title, "tags": f.tags, "body": f.body} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	return values
+}
+
+// filePath returns the form's file if it is a webnote file in the workspace.
+// Returns (path, nil) on success.
+// Returns ("", error) if the file is outside the workspace or does not end with .wn.
+func (f *sectionForm) filePath() (string, error) {
+	if !filepath.IsLocal(f.file) || !strings.HasSuffix(f.file, ".wn") {
+		return "", errors.New(fmt.Sprintf("Invalid file: %s, must be a .wn file in the workspace", f.file))
+	}
+	return filepath.Clean(f.file), nil
+}
+
+// apply sets the title, tags and body of a section to the form's values.
+// Empty values remove the field or body.
+// Returns nil on success.
+// Returns error if the tags are invalid, in which case the section is not changed.
+func (f *sectionForm) apply(o *options, sct *webnotes.Section) error {
+	tags, err := o.knownTags(f.tags)
+	if err != nil {
+		return err
+	}
+	if f.title == "" {
+		sct.DeleteField("title")
+	} else {
+		sct.SetFieldValue("title", f.title)
+	}
+	if err = sct.SetTags(tags); err != nil {
+		return err
+	}
+	body := strings.TrimRight(f.body, "\n")
+	if body == "" {
+		sct.SetBody([]string{})
+	} else {
+		sct.SetBody(strings.Split(body, "\n"))
+	}
+	return nil
+}
+
+// findSection returns the section of a WebNote with an ID.
+// Returns (section, nil) on success.
+// Returns (nil, error) if there is no section with the ID.
+func findSection(wn *webnotes.WebNote, id string) (*webnotes.Section, error) {
+	for _, sct := range wn.Sections {
+		if sctID, err := sct.ID(); err == nil && sctID == id {
+			return sct, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Webnote not found: %s in %s", id, wn.FilePath))
+}
+
+// sameOrigin returns true if a request was sent by a page of the webserver,
+// so pages of other sites can not post forms to it and change webnotes.
+// Browsers say where a request comes from with Sec-Fetch-Site, or with Origin if they are older.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+	default:
+		return false
+	}
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	return err == nil && origin.Host != "" && origin.Host == r.Host
+}
+
+// pageForbidden shows that a form posted from another site was not saved.
+func (h *httpHandler) pageForbidden(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusForbidden)
+	h.pageMessage(w, "Forms can only be posted from the pages of this webserver")
+}
+
+// pageAdd shows a form to add a webnote with suggested tags and adds the webnote when the form is posted.
+// The file is --out_file unless the form changes it, and the tags are the default tags in the configuration.
+func (h *httpHandler) pageAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !sameOrigin(r) {
+			h.pageForbidden(w)
+			return
+		}
+		filePath, err := h.addSection(r)
+		if err != nil {
+			h.pageError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/files/"+filepath.ToSlash(filePath), http.StatusSeeOther)
+		return
+	}
+	f := newSectionForm(r.URL.Query())
+	if len(r.URL.Query()) == 0 {
+		f.file = h.o.s["out_file"]
+		if h.o.config != nil {
+			f.tags = strings.Join(h.o.config.DefaultTags, ",")
+		}
+	}
+	var sct *webnotes.Section
+	if f.note != "" || f.url != "" {
+		var err error
+		sct, err = webnotes.NewSection(f.note, f.url)
+		if err != nil {
+			h.pageError(w, err)
+			return
+		}
+		if err = f.apply(h.o, sct); err != nil {
+			h.pageError(w, err)
+			return
+		}
+	}
+	h.writeSectionForm(w, "add", f, webnotes.NewWebNote(f.file), sct)
+}
+
+// addSection adds the webnote posted to the add form to its file.
+// Returns (file_path, nil) on success.
+// Returns ("", error) on failure.
+func (h *httpHandler) addSection(r *http.Request) (string, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", err
+	}
+	f := newSectionForm(r.PostForm)
+	filePath, err := f.filePath()
+	if err != nil {
+		return "", err
+	}
+	sct, err := webnotes.NewSection(f.note, f.url)
+	if err != nil {
+		return "", err
+	}
+	if err = f.apply(h.o, sct); err != nil {
+		return "", err
+	}
+	wn := webnotes.NewWebNote(filePath)
+	exists, err := webnotes.FileExists(filePath)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		wn, err = webnotes.LoadWebNote(filePath)
+		if err != nil {
+			return "", err
+		}
+	}
+	wn.AddSection(sct)
+	return filePath, webnotes.SaveWebNote(wn)
+}
+
+// pageEdit shows a form to edit the title, tags and body of a webnote with suggested tags
+// and saves the changes when the form is posted.
+// The webnote is the one with the id in the file given in the query.
+func (h *httpHandler) pageEdit(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost && !sameOrigin(r) {
+		h.pageForbidden(w)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		h.pageError(w, err)
+		return
+	}
+	f := newSectionForm(r.Form)
+	filePath, err := f.filePath()
+	if err != nil {
+		h.pageError(w, err)
+		return
+	}
+	wn, err := webnotes.LoadWebNote(filePath)
+	if err != nil {
+		h.pageError(w, err)
+		return
+	}
+	sct, err := findSection(wn, f.id)
+	if err != nil {
+		h.pageError(w, err)
+		return
+	}
+	if r.Method == http.MethodPost {
+		if err = f.apply(h.o, sct); err != nil {
+			h.pageError(w, err)
+			return
+		}
+		if err = webnotes.SaveWebNote(wn); err != nil {
+			h.pageError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/files/"+filepath.ToSlash(filePath), http.StatusSeeOther)
+		return
+	}
+	// the form is filled in from the webnote until it is submitted to suggest tags
+	if _, ok := r.Form["tags"]; ok {
+		if err = f.apply(h.o, sct); err != nil {
+			h.pageError(w, err)
+			return
+		}
+	} else {
+		f.title, _ = sct.FieldValue("title")
+		tags, _ := sct.FieldValues("tags")
+		f.tags = strings.Join(tags, ",")
+		f.body = strings.Join(sct.Body, "\n")
+	}
+	h.writeSectionForm(w, "edit", f, wn, sct)
+}
+
+// writeSectionForm writes the add or edit form with the tags suggested for the section of the WebNote.
+// The section has the form's values, it is nil if there is nothing to suggest tags for yet.
+// Each suggested tag links to the form with the tag added.
+func (h *httpHandler) writeSectionForm(w http.ResponseWriter, action string, f *sectionForm, wn *webnotes.WebNote, sct *webnotes.Section) {
+	suggestions := []*webnotes.TagSuggestion{}
+	if sct != nil {
+		threshold, err := h.o.threshold(webnotes.DefaultSuggestionConfidence)
+		if err != nil {
+			h.pageError(w, err)
+			return
+		}
+		suggester, err := newTagSuggester()
+		if err != nil {
+			h.pageError(w, err)
+			return
+		}
+		for _, ts := range suggester.Suggest(wn, sct) {
+			if ts.Confidence < threshold {
+				break
+			}
+			suggestions = append(suggestions, ts)
+		}
+	}
+	fmt.Fprintf(w, "<html><head></head><body>\n")
+	if f.id == "" {
+		fmt.Fprintf(w, "<a href=\"/\">main</a> | %s\n", action)
+	} else {
+		fmt.Fprintf(w, "<a href=\"/\">main</a> | %s | %s: %s\n", action, html.EscapeString(f.file), html.EscapeString(f.id))
+	}
+	fmt.Fprintf(w, "<hr>\n")
+	fmt.Fprintf(w, "<form action=\"/%s\" method=\"post\">\n", action)
+	if f.id == "" {
+		fmt.Fprintf(w, "<p>file: <input name=\"file\" value=\"%s\"></p>\n", html.EscapeString(f.file))
+		fmt.Fprintf(w, "<p>note: <input name=\"note\" value=\"%s\"> or url: <input name=\"url\" value=\"%s\"></p>\n",
+			html.EscapeString(f.note), html.EscapeString(f.url))
+	} else {
+		fmt.Fprintf(w, "<input type=\"hidden\" name=\"file\" value=\"%s\">\n", html.EscapeString(f.file))
+		fmt.Fprintf(w, "<input type=\"hidden\" name=\"id\" value=\"%s\">\n", html.EscapeString(f.id))
+	}
+	fmt.Fprintf(w, "<p>title: <input name=\"title\" value=\"%s\"></p>\n", html.EscapeString(f.title))
+	fmt.Fprintf(w, "<p>tags: <input name=\"tags\" value=\"%s\"></p>\n", html.EscapeString(f.tags))
+	if len(suggestions) > 0 {
+		links := []string{}
+		for _, ts := range suggestions {
+			values := f.values()
+			values.Set("tags", strings.Trim(f.tags+","+ts.Tag, ","))
+			links = append(links, fmt.Sprintf("<a href=\"/%s?%s\">%s</a> %.2f (%s)",
+				action, html.EscapeString(values.Encode()), html.EscapeString(ts.Tag), ts.Confidence, strings.Join(ts.Sources, ", ")))
+		}
+		fmt.Fprintf(w, "<p>suggested tags: %s</p>\n", strings.Join(links, ", "))
+	}
+	fmt.Fprintf(w, "<p><textarea name=\"body\" rows=\"10\" cols=\"80\">%s</textarea></p>\n", html.EscapeString(f.body))
+	fmt.Fprintf(w, "<input type=\"submit\" value=\"save\">\n")
+	fmt.Fprintf(w, "<input type=\"submit\" formmethod=\"get\" value=\"suggest tags\">\n")
+	fmt.Fprintf(w, "</form>\n")
+	fmt.Fprintf(w, "</body></html>")
+}
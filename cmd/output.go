@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/greglange/webnotes/pkg/webnotes"
+)
+
+// formats read commands can print with --format
+var outputFormats = []string{"csv", "json", "jsonl", "template", "tsv"}
+
+// Struct for a webnote printed by matches in a machine readable format.
+type sectionRecord struct {
+	File        string              `json:"file"`
+	Line        int                 `json:"line"`
+	ID          string              `json:"id"`
+	Note        string              `json:"note,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Author      string              `json:"author,omitempty"`
+	Date        string              `json:"date,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Type        string              `json:"type,omitempty"`
+	Status      string              `json:"status,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	Fields      map[string][]string `json:"fields,omitempty"`
+	Body        string              `json:"body,omitempty"`
+}
+
+var sectionColumns = []string{"file", "line", "id", "note", "url", "title", "description", "author", "date", "tags",
+	"type", "status", "error", "body"}
+
+// newSectionRecord returns the record for a section of a webnote.
+// Returns (*sectionRecord, nil) on success.
+// Returns (nil, error) on failure.
+func newSectionRecord(wn *webnotes.WebNote, sct *webnotes.Section) (*sectionRecord, error) {
+	id, err := sct.ID()
+	if err != nil {
+		return nil, err
+	}
+	r := &sectionRecord{File: wn.FilePath, ID: id, Note: sct.Note, URL: sct.URL, Fields: make(map[string][]string)}
+	if lines := wn.SectionLines(sct); lines != nil {
+		r.Line = lines.Section.Start
+	}
+	for _, f := range sct.Fields {
+		r.Fields[f.Name] = f.Values
+	}
+	value := func(name string) string {
+		v, _ := sct.FieldValue(name)
+		return v
+	}
+	r.Title = value("title")
+	r.Description = value("description")
+	r.Author = value("author")
+	r.Date = value("date")
+	r.Type = value("type")
+	r.Status = value("status")
+	r.Error = value("error")
+	r.Tags, _ = sct.FieldValues("tags")
+	r.Body = strings.Join(sct.Body, "\n")
+	return r, nil
+}
+
+func (r *sectionRecord) row() []string {
+	return []string{r.File, strconv.Itoa(r.Line), r.ID, r.Note, r.URL, r.Title, r.Description, r.Author, r.Date,
+		strings.Join(r.Tags, ","), r.Type, r.Status, r.Error, r.Body}
+}
+
+// Struct for a duplicate webnote printed by duplicates in a machine readable format.
+// Locations are like "Links.wn:12", one for each time the webnote appears.
+type duplicateRecord struct {
+	ID        string   `json:"id"`
+	Files     []string `json:"files"`
+	Locations []string `json:"locations"`
+}
+
+var duplicateColumns = []string{"id", "files", "locations"}
+
+func (r *duplicateRecord) row() []string {
+	return []string{r.ID, strings.Join(r.Files, ","), strings.Join(r.Locations, ",")}
+}
+
+// Struct for a webnote in a cluster printed by similar in a machine readable format.
+// Cluster numbers start at 1.
+type similarRecord struct {
+	Cluster    int     `json:"cluster"`
+	Similarity float64 `json:"similarity"`
+	File       string  `json:"file"`
+	Line       int     `json:"line"`
+	ID         string  `json:"id"`
+}
+
+var similarColumns = []string{"cluster", "similarity", "file", "line", "id"}
+
+func (r *similarRecord) row() []string {
+	return []string{strconv.Itoa(r.Cluster), strconv.FormatFloat(r.Similarity, 'f', 2, 64), r.File, strconv.Itoa(r.Line), r.ID}
+}
+
+// Struct for a tag suggested by suggest_tags in a machine readable format, one for each tag suggested for a webnote.
+// Sources are the kinds of evidence for the tag, like words or host.
+type suggestionRecord struct {
+	File       string   `json:"file"`
+	Line       int      `json:"line"`
+	ID         string   `json:"id"`
+	Tag        string   `json:"tag"`
+	Confidence float64  `json:"confidence"`
+	Sources    []string `json:"sources"`
+}
+
+var suggestionColumns = []string{"file", "line", "id", "tag", "confidence", "sources"}
+
+func (r *suggestionRecord) row() []string {
+	return []string{r.File, strconv.Itoa(r.Line), r.ID, r.Tag, strconv.FormatFloat(r.Confidence, 'f', 2, 64),
+		strings.Join(r.Sources, ",")}
+}
+
+// Struct for a count printed by stats in a machine readable format.
+// Kind is sections, untagged or undated for the totals, which have no Name,
+// tag, host, author, file or year for the counts of each, or tag_pair for two tags used together,
+// whose Name is the two tags joined with a comma and whose Overlap is set.
+type statRecord struct {
+	Kind    string  `json:"kind"`
+	Name    string  `json:"name,omitempty"`
+	Count   int     `json:"count"`
+	Overlap float64 `json:"overlap,omitempty"`
+}
+
+var statColumns = []string{"kind", "name", "count", "overlap"}
+
+func (r *statRecord) row() []string {
+	overlap := ""
+	if r.Kind == "tag_pair" {
+		overlap = strconv.FormatFloat(r.Overlap, 'f', 2, 64)
+	}
+	return []string{r.Kind, r.Name, strconv.Itoa(r.Count), overlap}
+}
+
+// Struct for a problem printed by lint in a machine readable format.
+type diagnosticRecord struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+var diagnosticColumns = []string{"file", "line", "column", "severity", "message"}
+
+func newDiagnosticRecord(d *webnotes.Diagnostic) *diagnosticRecord {
+	return &diagnosticRecord{d.FilePath, d.Line, d.Column, d.Severity, d.Message}
+}
+
+func (r *diagnosticRecord) row() []string {
+	return []string{r.File, strconv.Itoa(r.Line), strconv.Itoa(r.Column), r.Severity, r.Message}
+}
+
+// Struct for writing the records of a read command in the format chosen with --format.
+// json records are written as one array when the writer is closed, the other formats as they are written.
+type recordWriter struct {
+	format  string
+	columns []string
+	tmpl    *template.Template
+	csv     *csv.Writer
+	records []any
+}
+
+// recordWriter returns a writer for the --format and --template options.
+// Returns (nil, nil) if no format was chosen and the command prints text.
+// Returns (*recordWriter, nil) on success.
+// Returns (nil, error) if the format or template is invalid.
+func (o *options) recordWriter(columns []string) (*recordWriter, error) {
+	format := o.s["format"]
+	if format == "" && o.s["template"] != "" {
+		format = "template"
+	}
+	if format == "" {
+		return nil, nil
+	}
+	if !slices.Contains(outputFormats, format) {
+		return nil, errors.New(fmt.Sprintf("Invalid format: %s, must be one of %s", format, strings.Join(outputFormats, ", ")))
+	}
+	w := &recordWriter{format: format, columns: columns, records: []any{}}
+	switch format {
+	case "csv":
+		w.csv = csv.NewWriter(os.Stdout)
+		err := w.csv.Write(columns)
+		if err != nil {
+			return nil, err
+		}
+	case "tsv":
+		fmt.Println(strings.Join(columns, "\t"))
+	case "template":
+		if o.s["template"] == "" {
+			return nil, errors.New("The template format needs a --template, like {{.URL}}\\t{{.Title}}")
+		}
+		// shells pass \t and \n through as is
+		text := strings.NewReplacer(`\t`, "\t", `\n`, "\n").Replace(o.s["template"])
+		tmpl, err := template.New("record").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid template: %s", err))
+		}
+		w.tmpl = tmpl
+	}
+	return w, nil
+}
+
+// write writes a record.
+// row is the record's values in the order of the writer's columns.
+func (w *recordWriter) write(record any, row []string) error {
+	switch w.format {
+	case "csv":
+		return w.csv.Write(row)
+	case "json":
+		w.records = append(w.records, record)
+	case "jsonl":
+		b, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "template":
+		err := w.tmpl.Execute(os.Stdout, record)
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+	case "tsv":
+		escape := strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+		values := []string{}
+		for _, v := range row {
+			values = append(values, escape.Replace(v))
+		}
+		fmt.Println(strings.Join(values, "\t"))
+	}
+	return nil
+}
+
+// close finishes writing the records.
+func (w *recordWriter) close() error {
+	switch w.format {
+	case "csv":
+		w.csv.Flush()
+		return w.csv.Error()
+	case "json":
+		b, err := json.MarshalIndent(w.records, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	}
+	return nil
+}
+
+// Struct for the --format flag of the older form of the command line.
+// --format alone is the format command and --format=<format> chooses the output format.
+type formatFlag struct {
+	main  bool
+	value string
+}
+
+func (f *formatFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (f *formatFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *formatFlag) Set(s string) error {
+	if b, err := strconv.ParseBool(s); err == nil {
+		f.main = b
+		return nil
+	}
+	f.value = s
+	return nil
+}
+
+// errSilent is returned by a command that failed and has already printed why.
+var errSilent = errors.New("silent")
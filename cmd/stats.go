@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/greglange/webnotes/pkg/webnotes"
+)
+
+// Struct for a group of counts in stats, like the counts per tag.
+// kind is the kind of the group's records when stats are printed with --format.
+type statsGroup struct {
+	name   string
+	kind   string
+	counts []*webnotes.Count
+}
+
+// statsGroups returns the groups of counts of stats in the order they are shown.
+func statsGroups(stats *webnotes.Stats) []*statsGroup {
+	return []*statsGroup{
+		{"tags", "tag", stats.Tags},
+		{"hosts", "host", stats.Hosts},
+		{"authors", "author", stats.Authors},
+		{"files", "file", stats.Files},
+		{"years", "year", stats.Years},
+	}
+}
+
+// statRecords returns stats as records, the totals first, then each group's counts and then the tag pairs.
+func statRecords(stats *webnotes.Stats) []*statRecord {
+	records := []*statRecord{
+		{Kind: "sections", Count: stats.Sections},
+		{Kind: "untagged", Count: stats.Untagged},
+		{Kind: "undated", Count: stats.Undated},
+	}
+	for _, group := range statsGroups(stats) {
+		for _, c := range group.counts {
+			records = append(records, &statRecord{Kind: group.kind, Name: c.Name, Count: c.Count})
+		}
+	}
+	for _, p := range stats.TagPairs {
+		records = append(records, &statRecord{"tag_pair", p.Tags[0] + "," + p.Tags[1], p.Count, p.Overlap})
+	}
+	return records
+}
+
+func mainStats(o *options) error {
+	fps, err := o.matchingFiles()
+	if err != nil {
+		return err
+	}
+	sm, err := o.sectionMatcher()
+	if err != nil {
+		return err
+	}
+	w, err := o.recordWriter(statColumns)
+	if err != nil {
+		return err
+	}
+	counter := webnotes.NewStatsCounter()
+	for _, fp := range fps {
+		wn, indexes, err := sm.matchingSections(fp)
+		if err != nil {
+			return err
+		}
+		for _, i := range indexes {
+			counter.Add(wn, wn.Sections[i])
+		}
+	}
+	stats := counter.Stats()
+	if w != nil {
+		for _, r := range statRecords(stats) {
+			err = w.write(r, r.row())
+			if err != nil {
+				return err
+			}
+		}
+		return w.close()
+	}
+	fmt.Printf("sections: %d\n", stats.Sections)
+	fmt.Printf("untagged: %d\n", stats.Untagged)
+	fmt.Printf("undated: %d\n", stats.Undated)
+	for _, group := range statsGroups(stats) {
+		if len(group.counts) == 0 {
+			continue
+		}
+		fmt.Printf("%s:\n", group.name)
+		for _, c := range group.counts {
+			fmt.Printf("  %d %s\n", c.Count, c.Name)
+		}
+	}
+	if len(stats.TagPairs) > 0 {
+		fmt.Println("tag pairs:")
+		for _, p := range stats.TagPairs {
+			fmt.Printf("  %d %s + %s (overlap %.2f)\n", p.Count, p.Tags[0], p.Tags[1], p.Overlap)
+		}
+	}
+	return nil
+}
+
+// pageStats shows the statistics of all webnotes.
+func (h *httpHandler) pageStats(w http.ResponseWriter) {
+	fps, err := webnotes.GetWebNoteFiles(".")
+	if err != nil {
+		h.pageError(w, err)
+		return
+	}
+	counter := webnotes.NewStatsCounter()
+	skipped := []string{}
+	for _, fp := range fps {
+		wn, diagnostics, err := webnotes.ParseWebNote(fp)
+		if err != nil {
+			h.pageError(w, err)
+			return
+		}
+		if webnotes.HasErrors(diagnostics) {
+			skipped = append(skipped, fp)
+			continue
+		}
+		for _, sct := range wn.Sections {
+			counter.Add(wn, sct)
+		}
+	}
+	stats := counter.Stats()
+	fmt.Fprintf(w, "<html><head></head><body>\n")
+	fmt.Fprintf(w, "<a href=\"/\">main</a> | stats\n")
+	fmt.Fprintf(w, "<hr>\n")
+	fmt.Fprintf(w, "<p>sections: %d, untagged: %d, undated: %d</p>\n", stats.Sections, stats.Untagged, stats.Undated)
+	if len(skipped) > 0 {
+		fmt.Fprintf(w, "<p>skipped files with errors: %s</p>\n", html.EscapeString(strings.Join(skipped, ", ")))
+	}
+	for _, group := range statsGroups(stats) {
+		writeStatsTable(w, group.name, []string{"count", group.kind}, len(group.counts), func(i int) []string {
+			return []string{fmt.Sprint(group.counts[i].Count), group.counts[i].Name}
+		})
+	}
+	writeStatsTable(w, "tag pairs", []string{"count", "tags", "overlap"}, len(stats.TagPairs), func(i int) []string {
+		p := stats.TagPairs[i]
+		return []string{fmt.Sprint(p.Count), p.Tags[0] + " + " + p.Tags[1], fmt.Sprintf("%.2f", p.Overlap)}
+	})
+	fmt.Fprintf(w, "</body></html>")
+}
+
+// writeStatsTable writes a table of statistics with a heading.
+// Nothing is written if there are no rows.
+// Cells are escaped since names come from webnote files.
+func writeStatsTable(w io.Writer, heading string, columns []string, rows int, row func(i int) []string) {
+	if rows == 0 {
+		return
+	}
+	fmt.Fprintf(w, "<h3>%s</h3>\n<table>\n<tr>", html.EscapeString(heading))
+	for _, column := range columns {
+		fmt.Fprintf(w, "<th>%s</th>", html.EscapeString(column))
+	}
+	fmt.Fprintf(w, "</tr>\n")
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(w, "<tr>")
+		for _, value := range row(i) {
+			fmt.Fprintf(w, "<td>%s</td>", html.EscapeString(value))
+		}
+		fmt.Fprintf(w, "</tr>\n")
+	}
+	fmt.Fprintf(w, "</table>\n")
+}
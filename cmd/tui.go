@@ -0,0 +1,695 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/greglange/webnotes/pkg/webnotes"
+	"golang.org/x/term"
+)
+
+// The views of the terminal user interface.
+// The group views list files, tags or hosts and the sections view lists sections.
+const (
+	viewFiles    int = 0
+	viewTags     int = 1
+	viewHosts    int = 2
+	viewSections int = 3
+)
+
+var viewNames = []string{"files", "tags", "hosts", "sections"}
+
+// tuiSection is a section and the webnote file it is in.
+type tuiSection struct {
+	wn  *webnotes.WebNote
+	sct *webnotes.Section
+}
+
+// tuiGroup is a file, tag or host and the sections in it.
+type tuiGroup struct {
+	name     string
+	sections []*tuiSection
+}
+
+// tui is the state of the terminal user interface.
+type tui struct {
+	o      *options
+	in     *bufio.Reader
+	out    *bufio.Writer
+	width  int
+	height int
+	files  []*webnotes.WebNote
+	view   int
+	groups []*tuiGroup
+	group  *tuiGroup
+	// the group view the group was chosen in
+	groupView int
+	filter    string
+	sections  []*tuiSection
+	cursor    int
+	top       int
+	prompt    string
+	status    string
+}
+
+func mainTui(o *options) error {
+	fps, err := o.matchingFiles()
+	if err != nil {
+		return err
+	}
+	t := &tui{o: o, in: bufio.NewReader(os.Stdin), out: bufio.NewWriter(os.Stdout), width: 80, height: 24}
+	skipped := 0
+	for _, fp := range fps {
+		wn, err := webnotes.LoadWebNote(fp)
+		if err != nil {
+			skipped++
+			continue
+		}
+		t.files = append(t.files, wn)
+	}
+	if skipped > 0 {
+		t.status = fmt.Sprintf("Skipped %d files with errors, see --lint", skipped)
+	}
+	// without a terminal, keys are read from stdin as is, which lets the interface be scripted
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+	}
+	// use the alternate screen and hide the cursor
+	t.out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		t.out.WriteString("\x1b[?25h\x1b[?1049l")
+		t.out.Flush()
+	}()
+	t.setView(viewFiles)
+	return t.run()
+}
+
+// run reads and handles keys until q is pressed or there are no more keys.
+func (t *tui) run() error {
+	for {
+		t.draw()
+		key, err := t.readKey()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		t.status = ""
+		switch key {
+		case "q":
+			return nil
+		case "up", "k":
+			t.move(-1)
+		case "down", "j":
+			t.move(1)
+		case "tab":
+			t.group = nil
+			t.setView((t.view + 1) % len(viewNames))
+		case "1", "2", "3", "4":
+			t.group = nil
+			t.setView(int(key[0] - '1'))
+		case "/":
+			t.editFilter()
+		case "enter":
+			if t.view != viewSections && t.cursor < len(t.groups) {
+				t.group, t.groupView = t.groups[t.cursor], t.view
+				t.setView(viewSections)
+			}
+		case "esc":
+			if t.view == viewSections && t.group != nil {
+				t.setView(t.groupView)
+			}
+		default:
+			if t.view == viewSections && t.cursor < len(t.sections) {
+				if err := t.sectionAction(key, t.sections[t.cursor]); err != nil {
+					t.status = err.Error()
+				}
+			}
+		}
+	}
+}
+
+// readKey reads a key press.
+// Returns the character typed or the name of a special key like "up" or "enter".
+func (t *tui) readKey() (string, error) {
+	r, _, err := t.in.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch r {
+	case '\r', '\n':
+		return "enter", nil
+	case '\t':
+		return "tab", nil
+	case 0x7f, 0x08:
+		return "backspace", nil
+	case 0x03:
+		return "q", nil
+	case 0x1b:
+		// escape sequences for special keys arrive together, a lone escape is the escape key
+		if t.in.Buffered() < 2 {
+			return "esc", nil
+		}
+		next, _ := t.in.Peek(2)
+		if next[0] != '[' && next[0] != 'O' {
+			return "esc", nil
+		}
+		t.in.Discard(2)
+		switch next[1] {
+		case 'A':
+			return "up", nil
+		case 'B':
+			return "down", nil
+		}
+		return "", nil
+	}
+	return string(r), nil
+}
+
+// setView changes the view and reloads its list.
+func (t *tui) setView(view int) {
+	t.view = view
+	t.cursor, t.top = 0, 0
+	t.refresh()
+}
+
+// refresh reloads the list of the current view after a change.
+// The cursor stays on the same line if it can.
+func (t *tui) refresh() {
+	if t.view == viewSections {
+		sections := t.allSections()
+		if t.group != nil {
+			// the group is found again so changes made by actions are shown
+			sections = []*tuiSection{}
+			for _, g := range t.groupsFor(t.groupView) {
+				if g.name == t.group.name {
+					sections = g.sections
+				}
+			}
+		}
+		sm, err := filterMatcher(t.filter)
+		if err != nil {
+			t.status = err.Error()
+			sm, _ = filterMatcher("")
+		}
+		t.sections = []*tuiSection{}
+		for _, ts := range sections {
+			if sm.matches(ts.sct) {
+				t.sections = append(t.sections, ts)
+			}
+		}
+	} else {
+		t.groups = t.groupsFor(t.view)
+	}
+	t.move(0)
+}
+
+// allSections returns every section in the loaded files.
+func (t *tui) allSections() []*tuiSection {
+	sections := []*tuiSection{}
+	for _, wn := range t.files {
+		for _, sct := range wn.Sections {
+			if sct != nil {
+				sections = append(sections, &tuiSection{wn, sct})
+			}
+		}
+	}
+	return sections
+}
+
+// groupsFor returns the files, tags or hosts of the loaded sections, sorted by name.
+func (t *tui) groupsFor(view int) []*tuiGroup {
+	byName := map[string]*tuiGroup{}
+	names := []string{}
+	group := func(name string) *tuiGroup {
+		g, ok := byName[name]
+		if !ok {
+			g = &tuiGroup{name, []*tuiSection{}}
+			byName[name] = g
+			names = append(names, name)
+		}
+		return g
+	}
+	add := func(name string, ts *tuiSection) {
+		g := group(name)
+		g.sections = append(g.sections, ts)
+	}
+	for _, ts := range t.allSections() {
+		switch view {
+		case viewFiles:
+			add(ts.wn.FilePath, ts)
+		case viewTags:
+			tags, _ := ts.sct.FieldValues("tags")
+			for _, tag := range tags {
+				add(tag, ts)
+			}
+		case viewHosts:
+			if host, err := ts.sct.Host(); err == nil && ts.sct.URL != "" {
+				add(host, ts)
+			}
+		}
+	}
+	if view == viewFiles {
+		// files without sections are listed too so sections can be moved to them
+		for _, wn := range t.files {
+			group(wn.FilePath)
+		}
+	}
+	sort.Strings(names)
+	groups := make([]*tuiGroup, 0, len(names))
+	for _, name := range names {
+		groups = append(groups, byName[name])
+	}
+	return groups
+}
+
+// filterMatcher makes a sectionMatcher from a filter like "mtags=go etitle=News note".
+// The filter uses the names of the command line selectors, with a value after = for string selectors.
+// Values can not contain spaces.
+func filterMatcher(filter string) (*sectionMatcher, error) {
+	o := &options{map[string]bool{}, map[string]string{}, nil, nil}
+	for _, selector := range strings.Fields(filter) {
+		name, value, found := strings.Cut(selector, "=")
+		if !found {
+			if !slices.Contains(boolSectionMatchers, name) {
+				return nil, errors.New(fmt.Sprintf("Unknown selector: %s", name))
+			}
+			o.b[name] = true
+			continue
+		}
+		if len(name) < 2 || (name[0] != 'e' && name[0] != 'm') || !slices.Contains(sectionMatchers, name[1:]) {
+			return nil, errors.New(fmt.Sprintf("Unknown selector: %s", name))
+		}
+		o.s[name] = value
+	}
+	return o.sectionMatcher()
+}
+
+// move moves the cursor and scrolls the list so the cursor can be seen.
+func (t *tui) move(delta int) {
+	count := len(t.groups)
+	if t.view == viewSections {
+		count = len(t.sections)
+	}
+	t.cursor = max(0, min(t.cursor+delta, count-1))
+	rows := t.listRows()
+	if t.cursor < t.top {
+		t.top = t.cursor
+	} else if t.cursor >= t.top+rows {
+		t.top = t.cursor - rows + 1
+	}
+}
+
+// listRows returns the number of rows available for the list.
+func (t *tui) listRows() int {
+	return max(1, t.height-2)
+}
+
+// readLine shows a prompt on the bottom line and reads a line of input.
+// changed is called after every change to the input.
+// Returns (input, true) when enter is pressed.
+// Returns ("", false) when escape is pressed.
+func (t *tui) readLine(prompt, input string, changed func(string)) (string, bool) {
+	defer func() { t.prompt = "" }()
+	for {
+		t.prompt = prompt + ": " + input
+		t.draw()
+		key, err := t.readKey()
+		if err != nil {
+			return "", false
+		}
+		switch key {
+		case "enter":
+			return input, true
+		case "esc":
+			return "", false
+		case "backspace":
+			if input != "" {
+				_, size := utf8.DecodeLastRuneInString(input)
+				input = input[:len(input)-size]
+			}
+		case "tab", "up", "down", "":
+			continue
+		default:
+			input += key
+		}
+		if changed != nil {
+			changed(input)
+		}
+	}
+}
+
+// editFilter reads a new filter, filtering the sections as it is typed.
+func (t *tui) editFilter() {
+	old := t.filter
+	if t.view != viewSections {
+		t.group = nil
+		t.setView(viewSections)
+	}
+	filter, ok := t.readLine("filter", t.filter, func(filter string) {
+		t.filter = filter
+		t.refresh()
+	})
+	if ok {
+		t.filter = filter
+	} else {
+		t.filter = old
+	}
+	t.refresh()
+}
+
+// suggestedTags returns the most confident tags suggested for a section, to show in the tag prompt,
+// like " (suggested go, web)", or "" if there are none.
+// The loaded files are the corpus, so tags added since are taken into account.
+func (t *tui) suggestedTags(ts *tuiSection) string {
+	suggester := webnotes.NewTagSuggester()
+	for _, wn := range t.files {
+		for _, sct := range wn.Sections {
+			if sct != nil {
+				suggester.Add(wn, sct)
+			}
+		}
+	}
+	tags := []string{}
+	for _, suggestion := range suggester.Suggest(ts.wn, ts.sct) {
+		if suggestion.Confidence < webnotes.DefaultSuggestionConfidence || len(tags) == 3 {
+			break
+		}
+		tags = append(tags, suggestion.Tag)
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	return " (suggested " + strings.Join(tags, ", ") + ")"
+}
+
+// sectionAction does the action for a key pressed in the sections view.
+// Changes are saved with SaveWebNote.
+func (t *tui) sectionAction(key string, ts *tuiSection) error {
+	switch key {
+	case "t":
+		value, ok := t.readLine("tags to add"+t.suggestedTags(ts), "", nil)
+		if !ok || value == "" {
+			return nil
+		}
+		tags, err := t.o.knownTags(value)
+		if err != nil {
+			return err
+		}
+		if err := ts.sct.AddTags(tags); err != nil {
+			return err
+		}
+		if err := webnotes.SaveWebNote(ts.wn); err != nil {
+			return err
+		}
+		t.status = "Tagged " + sectionLabel(ts.sct)
+	case "m":
+		filePath, ok := t.readLine("move to file", "", nil)
+		if !ok || filePath == "" {
+			return nil
+		}
+		out, err := t.loadFile(filePath)
+		if err != nil {
+			return err
+		}
+		if out == ts.wn {
+			return nil
+		}
+		// the destination is saved first so the section is not lost if saving it fails
+		out.AddSection(ts.sct)
+		if err := webnotes.SaveWebNote(out); err != nil {
+			out.Sections = slices.DeleteFunc(out.Sections, func(sct *webnotes.Section) bool { return sct == ts.sct })
+			return err
+		}
+		ts.wn.Sections = slices.DeleteFunc(ts.wn.Sections, func(sct *webnotes.Section) bool { return sct == ts.sct })
+		if err := webnotes.SaveWebNote(ts.wn); err != nil {
+			return err
+		}
+		t.status = "Moved " + sectionLabel(ts.sct) + " to " + out.FilePath
+	case "d":
+		answer, ok := t.readLine("delete "+sectionLabel(ts.sct)+"? (y/n)", "", nil)
+		if !ok || answer != "y" {
+			return nil
+		}
+		ts.wn.Sections = slices.DeleteFunc(ts.wn.Sections, func(sct *webnotes.Section) bool { return sct == ts.sct })
+		if err := webnotes.SaveWebNote(ts.wn); err != nil {
+			return err
+		}
+		t.status = "Deleted " + sectionLabel(ts.sct)
+	case "h":
+		if ts.sct.URL == "" {
+			return errors.New("Only url sections can be head checked")
+		}
+		t.status = "Checking " + ts.sct.URL
+		t.draw()
+		ts.sct.Head()
+		if err := webnotes.SaveWebNote(ts.wn); err != nil {
+			return err
+		}
+		if value, ok := ts.sct.FieldValue("error"); ok {
+			t.status = "Error: " + value
+		} else if value, ok := ts.sct.FieldValue("status"); ok {
+			t.status = "Status: " + value
+		} else {
+			t.status = "OK"
+		}
+	case "o":
+		if ts.sct.URL == "" {
+			return errors.New("Only url sections can be opened in a browser")
+		}
+		if err := openBrowser(ts.sct.URL); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	t.refresh()
+	return nil
+}
+
+// loadFile returns the loaded webnote file with the file path.
+// A file that is not loaded is loaded or, if it does not exist, created when saved.
+func (t *tui) loadFile(filePath string) (*webnotes.WebNote, error) {
+	if !strings.HasSuffix(filePath, ".wn") {
+		return nil, errors.New("File must end with .wn")
+	}
+	filePath = filepath.Clean(filePath)
+	for _, wn := range t.files {
+		if filepath.Clean(wn.FilePath) == filePath {
+			return wn, nil
+		}
+	}
+	exists, err := webnotes.FileExists(filePath)
+	if err != nil {
+		return nil, err
+	}
+	wn := webnotes.NewWebNote(filePath)
+	if exists {
+		wn, err = webnotes.LoadWebNote(filePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.files = append(t.files, wn)
+	return wn, nil
+}
+
+// openBrowser opens a url in the browser set in $BROWSER or the system's default browser.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	if browser := strings.Fields(os.Getenv("BROWSER")); len(browser) > 0 {
+		cmd = exec.Command(browser[0], append(browser[1:], url)...)
+	} else {
+		switch runtime.GOOS {
+		case "darwin":
+			cmd = exec.Command("open", url)
+		case "windows":
+			cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+		default:
+			cmd = exec.Command("xdg-open", url)
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// sectionLabel returns the title of a section or, if it has none, its note or url.
+func sectionLabel(sct *webnotes.Section) string {
+	if title, ok := sct.FieldValue("title"); ok && title != "" {
+		return strings.ReplaceAll(title, "\n", " ")
+	}
+	id, _ := sct.ID()
+	return id
+}
+
+// renderSection returns the lines of the preview of a section.
+// The body is rendered from markdown to text.
+func renderSection(sct *webnotes.Section) []string {
+	id, _ := sct.ID()
+	lines := []string{id}
+	for _, field := range sct.Fields {
+		// multi-line values continue on indented lines like in webnote files
+		for i, line := range strings.Split(strings.Join(field.Values, ", "), "\n") {
+			if i == 0 {
+				lines = append(lines, field.Name+": "+line)
+			} else {
+				lines = append(lines, "  "+line)
+			}
+		}
+	}
+	lines = append(lines, "")
+	html := webnotes.MarkdownToHTML(strings.Join(sct.Body, "\n"))
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return append(lines, sct.Body...)
+	}
+	text := strings.TrimSpace(doc.Find("body").Text())
+	return append(lines, strings.Split(text, "\n")...)
+}
+
+// wrap splits lines so none are wider than width.
+func wrap(lines []string, width int) []string {
+	wrapped := []string{}
+	for _, line := range lines {
+		runes := []rune(strings.ReplaceAll(line, "\t", "    "))
+		for len(runes) > width {
+			wrapped = append(wrapped, string(runes[:width]))
+			runes = runes[width:]
+		}
+		wrapped = append(wrapped, string(runes))
+	}
+	return wrapped
+}
+
+// fit pads or cuts a line to width.
+// Control characters are replaced, see printable.
+func fit(line string, width int) string {
+	runes := []rune(printable(line))
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
+
+// printable returns a line with tabs changed to spaces and other control characters changed to U+FFFD,
+// so text from webnotes and fetched pages can not break the layout or send escape sequences to the terminal.
+func printable(line string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		} else if unicode.IsControl(r) {
+			return unicode.ReplacementChar
+		}
+		return r
+	}, line)
+}
+
+// draw draws the screen.
+// The top line has the views, the list is on the left with a preview on the right and
+// the bottom line has the status, a prompt or help for the keys.
+func (t *tui) draw() {
+	fd := int(os.Stdout.Fd())
+	if term.IsTerminal(fd) {
+		if width, height, err := term.GetSize(fd); err == nil {
+			t.width, t.height = width, height
+		}
+	}
+	listWidth := t.width
+	previewWidth := 0
+	if t.width >= 60 {
+		listWidth = t.width * 2 / 5
+		previewWidth = t.width - listWidth - 1
+	}
+	tabs := []string{}
+	for i, name := range viewNames {
+		if i == t.view {
+			name = "[" + name + "]"
+		}
+		tabs = append(tabs, fmt.Sprintf("%d %s", i+1, name))
+	}
+	header := strings.Join(tabs, "  ")
+	if t.view == viewSections {
+		if t.group != nil {
+			header += "  in " + t.group.name
+		}
+		if t.filter != "" {
+			header += "  filter: " + t.filter
+		}
+	}
+	list := []string{}
+	preview := []string{}
+	if t.view == viewSections {
+		for _, ts := range t.sections {
+			list = append(list, sectionLabel(ts.sct))
+		}
+		if t.cursor < len(t.sections) {
+			ts := t.sections[t.cursor]
+			preview = append([]string{ts.wn.FilePath}, renderSection(ts.sct)...)
+		}
+	} else {
+		for _, g := range t.groups {
+			list = append(list, fmt.Sprintf("%s (%d)", g.name, len(g.sections)))
+		}
+		if t.cursor < len(t.groups) {
+			for _, ts := range t.groups[t.cursor].sections {
+				preview = append(preview, sectionLabel(ts.sct))
+			}
+		}
+	}
+	if previewWidth > 0 {
+		preview = wrap(preview, previewWidth)
+	}
+	footer := t.prompt
+	if footer == "" {
+		footer = t.status
+	}
+	if footer == "" {
+		footer = "q quit  tab/1-4 views  j/k move  enter open  esc back  / filter"
+		if t.view == viewSections {
+			footer += "  t tag  m move  d delete  h head  o open"
+		}
+	}
+	t.out.WriteString("\x1b[H")
+	t.out.WriteString("\x1b[1m" + fit(header, t.width) + "\x1b[0m\x1b[K\r\n")
+	rows := t.listRows()
+	for row := 0; row < rows; row++ {
+		line := ""
+		if i := t.top + row; i < len(list) {
+			line = fit(list[i], listWidth)
+			if i == t.cursor {
+				line = "\x1b[7m" + line + "\x1b[0m"
+			}
+		} else {
+			line = fit("", listWidth)
+		}
+		if previewWidth > 0 {
+			line += "│"
+			if row < len(preview) {
+				line += fit(preview[row], previewWidth)
+			}
+		}
+		t.out.WriteString(line + "\x1b[K\r\n")
+	}
+	t.out.WriteString(fit(footer, t.width) + "\x1b[K")
+	t.out.Flush()
+}
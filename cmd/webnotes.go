@@ -5,42 +5,60 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"html"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
 	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/greglange/webnotes/pkg/webnotes"
 )
 
-// TODO: command line flag to specify a root directory instead of defaulting to current directory
-// TODO: check if the wrong or unused options are specified for each main?
 // TODO: maybe add md body specifier that tries to change html to markdown
 // TODO: maybe change options to context since it will have things that are not options
 
 var mainFuncs = map[string]func(*options) error{
-	"add":        mainAdd,
-	"append":     mainAppend,
-	"clear":      mainClear,
-	"combine":    mainCombine,
-	"copy":       mainCopy,
-	"delete":     mainDelete,
-	"duplicates": mainDuplicates,
-	"fill":       mainFill,
-	"format":     mainFormat,
-	"head":       mainHead,
-	"http":       mainHttp,
-	"index":      mainIndex,
-	"matches":    mainMatches,
-	"move":       mainMove,
-	"set":        mainSet,
-	"sort":       mainSort,
-	"tag":        mainTag,
+	"add":            mainAdd,
+	"append":         mainAppend,
+	"archive":        mainArchive,
+	"clean_tags":     mainCleanTags,
+	"clear":          mainClear,
+	"combine":        mainCombine,
+	"copy":           mainCopy,
+	"delete":         mainDelete,
+	"duplicates":     mainDuplicates,
+	"edit":           mainEdit,
+	"fill":           mainFill,
+	"format":         mainFormat,
+	"head":           mainHead,
+	"http":           mainHttp,
+	"index":          mainIndex,
+	"lint":           mainLint,
+	"matches":        mainMatches,
+	"merge":          mainMerge,
+	"merge_tags":     mainMergeTags,
+	"move":           mainMove,
+	"retag":          mainRetag,
+	"normalize_tags": mainNormalizeTags,
+	"normalize_urls": mainNormalizeUrls,
+	"set":            mainSet,
+	"similar":        mainSimilar,
+	"sort":           mainSort,
+	"stats":          mainStats,
+	"suggest_tags":   mainSuggestTags,
+	"tag":            mainTag,
+	"tui":            mainTui,
+	"untag":          mainUntag,
 }
 
 var boolSectionMatchers = []string{
@@ -48,7 +66,7 @@ var boolSectionMatchers = []string{
 }
 
 var sectionMatchers = []string{
-	"author", "body", "date", "description", "error", "host", "note", "status", "tags", "title", "url",
+	"author", "body", "date", "description", "error", "host", "note", "status", "tags", "title", "type", "url",
 }
 
 var boolValueSpecifiers = []string{
@@ -71,23 +89,42 @@ var stringValueSpecifiers = []string{
 var valueSpecifiers = []string{"author", "date", "description", "title"}
 
 type options struct {
-	b     map[string]bool
-	s     map[string]string
-	stdin *os.File
+	b      map[string]bool
+	s      map[string]string
+	stdin  *os.File
+	config *webnotes.Config
 }
 
 func getOptions() *options {
 	b := map[string]*bool{}
 	s := map[string]*string{}
-	boolFlags := append(append(append([]string{"verbose"}, boolValueSpecifiers...), boolBodySpecifiers...), boolSectionMatchers...)
+	boolFlags := append(append(append([]string{"apply", "cache_only", "fix", "ignore_robots", "locations", "verbose"}, boolValueSpecifiers...), boolBodySpecifiers...), boolSectionMatchers...)
 	stringFlags := []string{
 		// file matchers
-		"dir", "file",
+		"dir", "file", "root",
+		// fetcher
+		"cache_dir", "cache_ttl", "cookie_file", "headers_file", "host_interval", "max_body_size", "own_hosts", "proxy",
+		"timeout", "user_agent",
 		// others
-		"out_file"}
+		"home", "http_address", "lint_rules", "out_file", "priority", "template", "threshold", "warc_dir"}
 	for f, _ := range mainFuncs {
+		if _, ok := commandArgs[f]; ok || f == "format" {
+			continue
+		}
 		b[f] = flag.Bool(f, false, "")
 	}
+	// commands that take an argument take it as their flag's value, like --retag golang=go
+	for f := range commandArgs {
+		arg := &argFlag{}
+		flag.Var(arg, f, "")
+		b[f] = &arg.main
+		s[f] = &arg.value
+	}
+	// --format is both the format command and the output format of read commands
+	format := &formatFlag{}
+	flag.Var(format, "format", "")
+	b["format"] = &format.main
+	s["format"] = &format.value
 	for _, f := range boolFlags {
 		b[f] = flag.Bool(f, false, "")
 	}
@@ -106,7 +143,32 @@ func getOptions() *options {
 	}
 	flag.Usage = usage
 	flag.Parse()
-	o := options{make(map[string]bool), make(map[string]string), nil}
+	return newOptions(b, s)
+}
+
+// Struct for the flag of a main option that takes a value, like --retag golang=go.
+// Giving the flag chooses the main option.
+type argFlag struct {
+	main  bool
+	value string
+}
+
+func (f *argFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *argFlag) Set(s string) error {
+	f.main = true
+	f.value = s
+	return nil
+}
+
+// newOptions returns options with the values of parsed flags.
+func newOptions(b map[string]*bool, s map[string]*string) *options {
+	o := options{make(map[string]bool), make(map[string]string), nil, nil}
 	for k, v := range b {
 		o.b[k] = *v
 	}
@@ -158,6 +220,178 @@ func (o *options) outWebNotesFile() (*webnotes.WebNote, error) {
 	return wn, nil
 }
 
+// flags that are paths, which are relative to the current directory on the command line
+var pathFlags = []string{"cache_dir", "cookie_file", "dir", "file", "headers_file", "out_file", "warc_dir"}
+
+// applyConfig finds the configuration file and makes the workspace root the current directory.
+// The root is --root if it is given, then the root in the configuration file, then the current directory.
+// Settings in the configuration file are used for options not given on the command line.
+func (o *options) applyConfig() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	config, err := webnotes.FindConfig(cwd)
+	if err != nil {
+		return err
+	}
+	o.config = config
+	root := o.s["root"]
+	if root == "" && config != nil {
+		root = config.Root
+	}
+	if root == "" {
+		root = cwd
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	// relative paths given on the command line are changed to be relative to the root
+	for _, name := range pathFlags {
+		if o.s[name] == "" || filepath.IsAbs(o.s[name]) {
+			continue
+		}
+		rel, err := filepath.Rel(root, filepath.Join(cwd, o.s[name]))
+		if err != nil {
+			return err
+		}
+		o.s[name] = rel
+	}
+	if err := os.Chdir(root); err != nil {
+		return err
+	}
+	if config == nil {
+		return nil
+	}
+	if config.IndexPath != "" {
+		webnotes.IndexPath = config.IndexPath
+	}
+	webnotes.Canonicalizer = &config.URLs
+	if config.TagVocabulary != "" {
+		webnotes.Vocabulary, err = webnotes.LoadTagVocabulary(config.TagVocabulary)
+		if err != nil {
+			return err
+		}
+	}
+	f := config.Fetch
+	defaults := map[string]string{
+		"cache_dir":     f.CacheDir,
+		"cache_ttl":     f.CacheTTL,
+		"cookie_file":   f.CookieFile,
+		"headers_file":  f.HeadersFile,
+		"host_interval": f.HostInterval,
+		"http_address":  config.HTTPAddress,
+		"own_hosts":     strings.Join(f.OwnHosts, ","),
+		"out_file":      config.OutFile,
+		"proxy":         f.Proxy,
+		"timeout":       f.Timeout,
+		"user_agent":    f.UserAgent,
+		"warc_dir":      f.WARCDir,
+	}
+	if f.MaxBodySize > 0 {
+		defaults["max_body_size"] = strconv.FormatInt(f.MaxBodySize, 10)
+	}
+	for name, value := range defaults {
+		if o.s[name] == "" {
+			o.s[name] = value
+		}
+	}
+	o.b["cache_only"] = o.b["cache_only"] || f.CacheOnly
+	o.b["ignore_robots"] = o.b["ignore_robots"] || f.IgnoreRobots
+	return nil
+}
+
+// setupFetcher configures webnotes.DefaultFetcher from the fetcher options.
+func (o *options) setupFetcher() error {
+	f := webnotes.DefaultFetcher
+	if o.s["cache_dir"] != "" || o.s["cache_ttl"] != "" || o.b["cache_only"] {
+		dir := o.s["cache_dir"]
+		if dir == "" {
+			dir = webnotes.CachePath
+		}
+		ttl := 24 * time.Hour
+		if o.s["cache_ttl"] != "" {
+			var err error
+			ttl, err = time.ParseDuration(o.s["cache_ttl"])
+			if err != nil {
+				return errors.New("Invalid --cache_ttl")
+			}
+		}
+		f.Cache = webnotes.NewHTTPCache(dir, ttl)
+		f.Cache.Only = o.b["cache_only"]
+	}
+	if o.s["cookie_file"] != "" {
+		f.CookieFile = o.s["cookie_file"]
+	}
+	if o.s["headers_file"] != "" {
+		headers, err := webnotes.LoadHeadersFile(o.s["headers_file"])
+		if err != nil {
+			return err
+		}
+		f.Headers = headers
+	}
+	if o.s["host_interval"] != "" {
+		interval, err := time.ParseDuration(o.s["host_interval"])
+		if err != nil {
+			return errors.New("Invalid --host_interval")
+		}
+		f.MinInterval = interval
+	}
+	if o.b["ignore_robots"] {
+		f.RobotsTxt = false
+	}
+	if o.s["max_body_size"] != "" {
+		size, err := strconv.ParseInt(o.s["max_body_size"], 10, 64)
+		if err != nil {
+			return errors.New("Invalid --max_body_size")
+		}
+		f.MaxBodySize = size
+	}
+	if o.s["own_hosts"] != "" {
+		f.OwnHosts = strings.Split(o.s["own_hosts"], ",")
+	}
+	if o.s["proxy"] != "" {
+		f.Proxy = o.s["proxy"]
+	}
+	if o.s["timeout"] != "" {
+		timeout, err := time.ParseDuration(o.s["timeout"])
+		if err != nil {
+			return errors.New("Invalid --timeout")
+		}
+		f.Timeout = timeout
+	}
+	if o.s["user_agent"] != "" {
+		f.UserAgent = o.s["user_agent"]
+	}
+	return nil
+}
+
+func (o *options) warcDir() string {
+	if o.s["warc_dir"] != "" {
+		return o.s["warc_dir"]
+	}
+	return webnotes.WARCPath
+}
+
+// startWARC sets up archiving of fetched pages to WARC files.
+// Archiving only happens if --warc_dir is given unless always is true.
+// The returned function must be called to close the WARC file.
+func (o *options) startWARC(always bool) (func(), error) {
+	if !always && o.s["warc_dir"] == "" {
+		return func() {}, nil
+	}
+	ww, err := webnotes.NewWARCWriter(o.warcDir())
+	if err != nil {
+		return nil, err
+	}
+	webnotes.DefaultFetcher.WARC = ww
+	return func() {
+		webnotes.DefaultFetcher.WARC = nil
+		ww.Close()
+	}, nil
+}
+
 type fileMatcher struct {
 	dir  string
 	file string
@@ -324,7 +558,7 @@ func (sm *sectionMatcher) matches(sct *webnotes.Section) bool {
 		tags = tags && sct.FieldHasValues("tags", sm.etags)
 	}
 	if len(sm.mtags) > 0 {
-		tags = tags && sct.FieldHasValue("tags", sm.mtags)
+		tags = tags && sct.HasTagUnder(sm.mtags)
 	}
 	return bools && equals && matches && tags
 }
@@ -348,10 +582,11 @@ type httpHandler struct {
 	o          *options
 	index_     map[string][]*webnotes.IndexEntry
 	noteIndex_ []string
+	warcIndex_ map[string]*webnotes.WARCIndexEntry
 }
 
 func newHttpHandler(o *options) (*httpHandler, error) {
-	return &httpHandler{o, make(map[string][]*webnotes.IndexEntry), nil}, nil
+	return &httpHandler{o, make(map[string][]*webnotes.IndexEntry), nil, nil}, nil
 }
 
 func (h *httpHandler) index(name string) ([]*webnotes.IndexEntry, error) {
@@ -380,6 +615,24 @@ func (h *httpHandler) noteIndex() ([]string, error) {
 	return h.noteIndex_, nil
 }
 
+// warcIndex returns the latest WARC index entry for each archived url.
+// The entries are keyed by the MD5 of the url.
+// If there is no WARC index, the returned map is empty.
+func (h *httpHandler) warcIndex() map[string]*webnotes.WARCIndexEntry {
+	if h.warcIndex_ == nil {
+		h.warcIndex_ = make(map[string]*webnotes.WARCIndexEntry)
+		index, err := webnotes.LoadWARCIndex(h.o.warcDir())
+		if err != nil {
+			return h.warcIndex_
+		}
+		for _, entry := range index {
+			md5_ := fmt.Sprintf("%x", md5.Sum([]byte(entry.URL)))
+			h.warcIndex_[md5_] = entry
+		}
+	}
+	return h.warcIndex_
+}
+
 func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// this is supposed to prevent the browser from caching pages
 	// https://stackoverflow.com/questions/69597242/golang-prevent-browser-cache-pages-when-cli
@@ -390,34 +643,48 @@ func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if r.URL.Path == "/" {
 		h.pageMain(w)
+	} else if r.URL.Path == "/add" {
+		h.pageAdd(w, r)
 	} else if r.URL.Path == "/authors" {
-		h.pageIndex(w, "authors")
+		h.pageIndex(w, "authors", r.URL.Query())
+	} else if r.URL.Path == "/edit" {
+		h.pageEdit(w, r)
 	} else if r.URL.Path == "/hosts" {
-		h.pageIndex(w, "hosts")
+		h.pageIndex(w, "hosts", r.URL.Query())
 	} else if r.URL.Path == "/files" {
 		h.pageFiles(w)
 	} else if r.URL.Path == "/notes" {
 		h.pageNotesIndex(w)
+	} else if r.URL.Path == "/stats" {
+		h.pageStats(w)
 	} else if r.URL.Path == "/tags" {
-		h.pageIndex(w, "tags")
+		h.pageIndex(w, "tags", r.URL.Query())
 	} else {
 		parts := strings.Split(r.URL.Path[1:], "/")
 		if len(parts) < 2 {
 			h.pageMessage(w, "Invalid url")
 			return
 		}
-		if parts[0] == "authors" {
+		if parts[0] == "archive" {
+			if len(parts) > 2 {
+				h.pageMessage(w, "Invalid url")
+				return
+			}
+			h.pageArchive(w, parts[1])
+		} else if parts[0] == "authors" {
 			if len(parts) > 2 {
 				h.pageMessage(w, "Invalid url")
+				return
 			}
 			h.pageIndexFile(w, "authors", parts[1])
 		} else if parts[0] == "files" {
 			filePath := filepath.Join(parts[1:len(parts)]...)
 			urlPath := fmt.Sprintf("/files/%s", filePath)
-			h.pageFile(w, filePath, urlPath, "files | "+filePath)
+			h.pageFile(w, filePath, urlPath, "files | "+filePath, true)
 		} else if parts[0] == "hosts" {
 			if len(parts) > 2 {
 				h.pageMessage(w, "Invalid url")
+				return
 			}
 			h.pageIndexFile(w, "hosts", parts[1])
 		} else if parts[0] == "notes" {
@@ -426,6 +693,7 @@ func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		} else if parts[0] == "tags" {
 			if len(parts) > 2 {
 				h.pageMessage(w, "Invalid url")
+				return
 			}
 			h.pageIndexFile(w, "tags", parts[1])
 		} else {
@@ -434,11 +702,36 @@ func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *httpHandler) pageArchive(w http.ResponseWriter, md5_ string) {
+	entry, ok := h.warcIndex()[md5_]
+	if !ok {
+		h.pageMessage(w, "Archived page not found")
+		return
+	}
+	resp, err := webnotes.ReadWARCResponse(h.o.warcDir(), entry)
+	if err != nil {
+		h.pageError(w, err)
+		return
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	// archived pages are served from the same origin as the pages that change webnotes,
+	// so they are sandboxed to keep their scripts from using it
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
 func (h *httpHandler) pageError(w http.ResponseWriter, err error) {
 	h.pageMessage(w, err.Error())
 }
 
-func (h *httpHandler) pageFile(w http.ResponseWriter, filePath, urlPath, msg string) {
+// pageFile shows the webnotes in a file.
+// Webnotes in files that are editable, the files of the workspace and not of the index, link to the edit form.
+func (h *httpHandler) pageFile(w http.ResponseWriter, filePath, urlPath, msg string, editable bool) {
 	wn, err := webnotes.LoadWebNote(filePath)
 	if err != nil {
 		h.pageError(w, err)
@@ -448,11 +741,20 @@ func (h *httpHandler) pageFile(w http.ResponseWriter, filePath, urlPath, msg str
 	fmt.Fprintf(w, "<a href=\"/\">main</a> | %s\n", msg)
 	for _, sct := range wn.Sections {
 		fmt.Fprintf(w, "<hr>\n")
+		edit := ""
+		if id, err := sct.ID(); err == nil && editable {
+			values := url.Values{"file": {filepath.ToSlash(filePath)}, "id": {id}}
+			edit = fmt.Sprintf(" (<a href=\"/edit?%s\">edit</a>)", html.EscapeString(values.Encode()))
+		}
 		if sct.Note != "" {
-			fmt.Fprintf(w, "<p><a id=\"%s\" href=\"%s#%s\">#</a> note://%s</a></p>\n", sct.Note, urlPath, sct.Note, sct.Note)
+			fmt.Fprintf(w, "<p><a id=\"%s\" href=\"%s#%s\">#</a> note://%s</a>%s</p>\n", sct.Note, urlPath, sct.Note, sct.Note, edit)
 		} else if sct.URL != "" {
 			md5_ := fmt.Sprintf("%x", md5.Sum([]byte(sct.URL)))
-			fmt.Fprintf(w, "<p><a id=\"%s\" href=\"%s#%s\">#</a> <a href=\"%s\">%s</a></p>\n", md5_, urlPath, md5_, sct.URL, sct.URL)
+			archive := ""
+			if _, ok := h.warcIndex()[md5_]; ok {
+				archive = fmt.Sprintf(" (<a href=\"/archive/%s\">archive</a>)", md5_)
+			}
+			fmt.Fprintf(w, "<p><a id=\"%s\" href=\"%s#%s\">#</a> <a href=\"%s\">%s</a>%s%s</p>\n", md5_, urlPath, md5_, sct.URL, sct.URL, archive, edit)
 		} else {
 			// this should not happen with a well formed section
 			fmt.Fprintf(w, "<p><a href=\"https://example.com\">https://example.com</a></p>\n")
@@ -507,32 +809,187 @@ func (h *httpHandler) pageIndexFile(w http.ResponseWriter, indexName string, md5
 	filePath := filepath.Join(webnotes.IndexPath, indexName, fmt.Sprintf("%s.wn", md5_))
 	urlPath := fmt.Sprintf("/%s/%s", indexName, md5_)
 	link := fmt.Sprintf("<a href=\"/%s\">%s</a>", indexName, indexName)
-	h.pageFile(w, filePath, urlPath, link+" | "+name)
+	h.pageFile(w, filePath, urlPath, link+" | "+name, false)
 }
 
-func (h *httpHandler) pageIndex(w http.ResponseWriter, indexName string) {
+// pageIndex lists the names in an index with the number of webnotes of each.
+// The query can set view to list or cloud, or tree for tags, which is the default for tags,
+// sort to name or count, and prefix to only show names that start with it.
+func (h *httpHandler) pageIndex(w http.ResponseWriter, indexName string, query url.Values) {
 	indexEntries, err := h.index(indexName)
 	if err != nil {
 		h.pageError(w, err)
 		return
 	}
+	views := []string{"list", "cloud"}
+	if indexName == "tags" {
+		views = append([]string{"tree"}, views...)
+	}
+	view := query.Get("view")
+	if view == "" {
+		view = views[0]
+	}
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = "name"
+	}
+	if !slices.Contains(views, view) || (sortBy != "name" && sortBy != "count") {
+		h.pageMessage(w, "Invalid url")
+		return
+	}
+	prefix := query.Get("prefix")
+	entries := []*webnotes.IndexEntry{}
+	for _, ie := range indexEntries {
+		if strings.HasPrefix(strings.ToLower(ie.Name), strings.ToLower(prefix)) {
+			entries = append(entries, ie)
+		}
+	}
+	if sortBy == "count" {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Count > entries[j].Count })
+	}
+	link := func(label, view, sortBy string) string {
+		values := url.Values{"view": {view}, "sort": {sortBy}}
+		if prefix != "" {
+			values.Set("prefix", prefix)
+		}
+		return fmt.Sprintf("<a href=\"/%s?%s\">%s</a>", indexName, values.Encode(), label)
+	}
 	fmt.Fprintf(w, "<html><head></head><body>\n")
 	fmt.Fprintf(w, "<a href=\"/\">main</a> | %s\n", indexName)
-	fmt.Fprintf(w, "<hr>")
-	for _, ie := range indexEntries {
-		fmt.Fprintf(w, "<p><a href=\"/%s/%s\">%s</a></p>\n", indexName, ie.MD5, ie.Name)
+	fmt.Fprintf(w, "<hr>\n")
+	fmt.Fprintf(w, "<form action=\"/%s\">\nview:", indexName)
+	for _, v := range views {
+		if v == view {
+			fmt.Fprintf(w, " %s", v)
+		} else {
+			fmt.Fprintf(w, " %s", link(v, v, sortBy))
+		}
+	}
+	fmt.Fprintf(w, " | sort:")
+	for _, s := range []string{"name", "count"} {
+		if s == sortBy {
+			fmt.Fprintf(w, " %s", s)
+		} else {
+			fmt.Fprintf(w, " %s", link(s, view, s))
+		}
+	}
+	fmt.Fprintf(w, " | prefix: <input name=\"prefix\" value=\"%s\">\n", html.EscapeString(prefix))
+	fmt.Fprintf(w, "<input type=\"hidden\" name=\"view\" value=\"%s\">\n", view)
+	fmt.Fprintf(w, "<input type=\"hidden\" name=\"sort\" value=\"%s\">\n", sortBy)
+	fmt.Fprintf(w, "<input type=\"submit\" value=\"filter\">\n</form>\n")
+	fmt.Fprintf(w, "<hr>\n")
+	switch view {
+	case "tree":
+		writeTagTree(w, indexEntries, entries, sortBy == "count")
+	case "cloud":
+		writeIndexCloud(w, indexName, entries)
+	default:
+		for _, ie := range entries {
+			fmt.Fprintf(w, "<p><a href=\"/%s/%s\">%s</a> (%d)</p>\n", indexName, ie.MD5, html.EscapeString(ie.Name), ie.Count)
+		}
 	}
 	fmt.Fprintf(w, "</body></html>")
 }
 
+// writeIndexCloud writes the names in an index as a cloud, the more webnotes a name has the bigger it is.
+func writeIndexCloud(w io.Writer, indexName string, entries []*webnotes.IndexEntry) {
+	// sizes go with the log of the counts so a few big names do not make the rest tiny
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, ie := range entries {
+		weight := math.Log(float64(ie.Count + 1))
+		low, high = math.Min(low, weight), math.Max(high, weight)
+	}
+	fmt.Fprintf(w, "<p style=\"line-height: 2\">\n")
+	for _, ie := range entries {
+		size := 100.0
+		if high > low {
+			size = 80 + 160*(math.Log(float64(ie.Count+1))-low)/(high-low)
+		}
+		fmt.Fprintf(w, "<a href=\"/%s/%s\" title=\"%d\" style=\"font-size: %.0f%%\">%s</a>\n",
+			indexName, ie.MD5, ie.Count, size, html.EscapeString(ie.Name))
+	}
+	fmt.Fprintf(w, "</p>\n")
+}
+
+// Struct for a tag in the hierarchy shown by the tags page.
+// A tag without an index entry has an empty MD5.
+type tagNode struct {
+	name     string
+	md5_     string
+	count    int
+	children []*tagNode
+}
+
+// writeTagTree writes tags as a collapsible hierarchy with the number of webnotes under each tag.
+// Only the tags in entries are shown, along with the tags above them, whose counts come from indexEntries.
+func writeTagTree(w io.Writer, indexEntries, entries []*webnotes.IndexEntry, byCount bool) {
+	all := make(map[string]*webnotes.IndexEntry)
+	for _, ie := range indexEntries {
+		all[ie.Name] = ie
+	}
+	roots := []*tagNode{}
+	nodes := make(map[string]*tagNode)
+	var node func(tag string) *tagNode
+	node = func(tag string) *tagNode {
+		if n, ok := nodes[tag]; ok {
+			return n
+		}
+		n := &tagNode{name: tag}
+		if ie, ok := all[tag]; ok {
+			n.md5_ = ie.MD5
+			n.count = ie.Count
+		}
+		nodes[tag] = n
+		ancestors := webnotes.TagAncestors(tag)
+		if len(ancestors) == 0 {
+			roots = append(roots, n)
+		} else {
+			parent := node(ancestors[len(ancestors)-1])
+			parent.children = append(parent.children, n)
+		}
+		return n
+	}
+	// ancestors come first, so siblings are in the order of entries
+	for _, ie := range entries {
+		for _, tag := range webnotes.TagAncestors(ie.Name) {
+			node(tag)
+		}
+		node(ie.Name)
+	}
+	var writeNodes func(nodes []*tagNode)
+	writeNodes = func(nodes []*tagNode) {
+		if byCount {
+			sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].count > nodes[j].count })
+		}
+		fmt.Fprintf(w, "<ul>\n")
+		for _, n := range nodes {
+			label := html.EscapeString(n.name[strings.LastIndex(n.name, webnotes.TagSeparator)+1:])
+			if n.md5_ != "" {
+				label = fmt.Sprintf("<a href=\"/tags/%s\">%s</a> (%d)", n.md5_, label, n.count)
+			}
+			if len(n.children) == 0 {
+				fmt.Fprintf(w, "<li>%s</li>\n", label)
+				continue
+			}
+			fmt.Fprintf(w, "<li><details><summary>%s</summary>\n", label)
+			writeNodes(n.children)
+			fmt.Fprintf(w, "</details></li>\n")
+		}
+		fmt.Fprintf(w, "</ul>\n")
+	}
+	writeNodes(roots)
+}
+
 func (h *httpHandler) pageMain(w http.ResponseWriter) {
 	fmt.Fprintf(w, "<html><head></head><body>\n")
 	fmt.Fprintf(w, "<a href=\"/\">main</a> | main")
 	fmt.Fprintf(w, "<hr>")
+	fmt.Fprintf(w, "<p><a href=\"/add\">add</a></p>\n")
 	fmt.Fprintf(w, "<p><a href=\"/authors\">authors</a></p>\n")
 	fmt.Fprintf(w, "<p><a href=\"/hosts\">hosts</a></p>\n")
 	fmt.Fprintf(w, "<p><a href=\"/files\">files</a></p>\n")
 	fmt.Fprintf(w, "<p><a href=\"/notes\">notes</a></p>\n")
+	fmt.Fprintf(w, "<p><a href=\"/stats\">stats</a></p>\n")
 	fmt.Fprintf(w, "<p><a href=\"/tags\">tags</a></p>\n")
 	fmt.Fprintf(w, "</body></html>")
 }
@@ -585,30 +1042,79 @@ func (h *httpHandler) pageNotesIndexFile(w http.ResponseWriter, filePath string)
 
 func usage() {
 	fmt.Println("Usage of webnotes:")
+	fmt.Println("  webnotes <command> [flags] only accepts the flags of the command, see webnotes help")
+	fmt.Println("  webnotes --<command> [flags] is the older form described here")
 	fmt.Println(" main selectors:")
 	fmt.Println("  These choose what the webnote command will do")
 	fmt.Println("  --add : adds a webnote")
 	fmt.Println("  --append : appends to webnotes' bodies")
+	fmt.Println("  --archive : archives webnotes' urls to WARC files")
+	fmt.Println("    Webnote files are not changed. Urls that could not be fetched or did not return 200 are printed.")
+	fmt.Println("  --clean_tags : changes invalid tags in webnotes to valid ones and removes empty tags")
+	fmt.Println("    Tags are lower case letters, digits, - _ . + # and / between levels, with at most 64 characters.")
 	fmt.Println("  --clear : clears webnotes fields and/or bodies")
 	fmt.Println("  --combine : combines webnotes with the same note string or url")
 	fmt.Println("  --copy : copies webnotes to a different file")
 	fmt.Println("  --delete : deletes webnotes")
 	fmt.Println("  --duplicates : prints duplicate webnotes")
+	fmt.Println("    --combine and --duplicates compare urls ignoring http or https, www., a trailing slash,")
+	fmt.Println("    the fragment and tracking parameters like utm_source. [urls] in .webnotes.toml changes this.")
+	fmt.Println("  --edit : edits webnotes in $EDITOR and saves the changes back to their files")
 	fmt.Println("  --fill : sets webnotes fields and/or bodies if not already set")
 	fmt.Println("  --format : loads webnote files and saves them standard formating")
 	fmt.Println("  --head : does an HTTP head on webnotes")
 	fmt.Println("  --http : runs a webserver so webnotes can be viewed in browser")
+	fmt.Println("    The tags, hosts and authors pages show how many webnotes each has, and can sort by count,")
+	fmt.Println("    show a cloud and filter by prefix. Indexes built before counts were stored show 0, run --index.")
+	fmt.Println("    The add page and the edit links of webnotes in files are forms that suggest tags like --suggest_tags,")
+	fmt.Println("    --threshold sets their least confidence and --out_file the file the add page adds to.")
 	fmt.Println("  --index : builds the index for a set of webnotes")
+	fmt.Println("    Files with errors are left out of the index and their errors are printed.")
+	fmt.Println("  --lint : prints every problem found in webnote files")
 	fmt.Println("  --matches : prints webnotes that match comand line selectors")
+	fmt.Println("  --merge : merges duplicate webnotes across files into one of them and fixes links to moved notes")
+	fmt.Println("    --home oldest|tags|priority chooses the webnote kept: the oldest date (the default), the most tags,")
+	fmt.Println("    or the first file in --priority <files>, a comma separated list.")
+	fmt.Println("  --merge_tags <tags>=<tag> : replaces tags with one tag, like --merge_tags js,javascript=javascript")
 	fmt.Println("  --move : moves webnotes to a different file")
+	fmt.Println("  --normalize_tags : changes tag aliases in webnotes to the tags of the tag vocabulary")
+	fmt.Println("  --normalize_urls : rewrites webnotes' urls without tracking parameters, fragments and default ports")
+	fmt.Println("  --retag <old>=<new> : renames a tag, like --retag golang=go")
 	fmt.Println("  --set : sets webnotes fields and/or bodies")
+	fmt.Println("  --similar : prints clusters of webnotes whose titles and bodies are nearly the same")
+	fmt.Println("    --threshold <similarity> sets how similar, from 0 to 1, webnotes must be, defaults to 0.8.")
 	fmt.Println("  --sort : sorts the sections in webnote files")
+	fmt.Println("  --stats : prints counts of webnotes per tag, host, author, file and year and of tags used together")
+	fmt.Println("    --format and --template print them as records of kind, name, count and overlap.")
+	fmt.Println("  --suggest_tags : prints tags suggested for webnotes by the tags of webnotes from the same host,")
+	fmt.Println("    with the same distinctive words or with the same links, and how confident each suggestion is.")
+	fmt.Println("    --threshold <confidence> sets the least confidence, from 0 to 1, defaults to 0.6.")
+	fmt.Println("    --apply adds the suggested tags instead of printing them.")
+	fmt.Println("    --format and --template print them as records of file, line, id, tag, confidence and sources.")
 	fmt.Println("  --tag : puts a tag on webnotes")
+	fmt.Println("  --tui : browses and curates webnotes in a terminal user interface")
+	fmt.Println("    Views list files, tags and hosts. Enter shows a group's webnotes and / filters webnotes")
+	fmt.Println("    with selectors like \"mtags=go etitle=News note\". Keys tag, move, delete, head check")
+	fmt.Println("    and open webnotes in a browser.")
+	fmt.Println("  --untag : removes tags from webnotes, like --vtags old,unused")
 	fmt.Println(" file selectors:")
 	fmt.Println("  These choose which files the webnote command will operate on.")
 	fmt.Println("  Defaults to all files.")
 	fmt.Println("  --dir <directory>")
 	fmt.Println("  --file <file>")
+	fmt.Println(" workspace:")
+	fmt.Println("  Webnote files are searched for in the workspace root, which defaults to the current directory.")
+	fmt.Println("  A " + webnotes.ConfigFileName + " file in the current directory or one above it can set the root,")
+	fmt.Println("  out_file, index_path, http_address, default_tags (used by --add when --vtags is not given)")
+	fmt.Println("  and, in a [fetch] table, the fetch specifiers. Command line options override it.")
+	fmt.Println("  tag_vocabulary names a file of canonical tags and their aliases, like:")
+	fmt.Println("    [tags.javascript]")
+	fmt.Println("    aliases = [\"js\", \"ecmascript\"]")
+	fmt.Println("    description = \"The JavaScript language\"")
+	fmt.Println("  Aliases in --vtags and selectors are changed to their tags. Tags not in the vocabulary are")
+	fmt.Println("  allowed, warned about or rejected, as unknown_tags = \"allow\", \"warn\" (the default) or \"reject\" says.")
+	fmt.Println("  --root <directory> : the workspace root")
+	fmt.Println("  --http_address <address> : address --http listens on, defaults to :8080")
 	fmt.Println(" bool webnote selectors:")
 	fmt.Println("  --note : matches notes")
 	fmt.Println("  --url : matchers urls")
@@ -625,7 +1131,9 @@ func usage() {
 	fmt.Println("  --enote, mnote <string>: note string")
 	fmt.Println("  --estatus, mstatus <string>: status field")
 	fmt.Println("  --etags, mtags <string>: tags field")
+	fmt.Println("    Tags like lang/go/generics are hierarchical and --mtags lang/go also matches the tags below lang/go.")
 	fmt.Println("  --etitle, mtitle <string>: title field")
+	fmt.Println("  --etype, mtype <string>: type field (image, pdf or text)")
 	fmt.Println("  --eurl, murl <string>: url")
 	fmt.Println(" boolean webnote selectors:")
 	fmt.Println("  These specify the part of the webnote to operate on.")
@@ -657,6 +1165,47 @@ func usage() {
 	fmt.Println(" output file specifier:")
 	fmt.Println("  This specifies which file output is written to.")
 	fmt.Println("  --out_file <file>")
+	fmt.Println(" location specifier:")
+	fmt.Println("  --locations : --matches and --duplicates print the file and line of each webnote, like Links.wn:12")
+	fmt.Println(" output format specifiers:")
+	fmt.Println("  These configure the output of --matches, --duplicates, --lint, --similar and --stats.")
+	fmt.Println("  --format=<format> : one of csv, json, jsonl, template or tsv, = is needed since --format alone is a main option")
+	fmt.Println("  --template <template> : Go text/template for each webnote, like {{.URL}}\\t{{.Title}}")
+	fmt.Println(" lint specifiers:")
+	fmt.Println("  These configure --lint.")
+	fmt.Println("  --fix : corrects the problems that are safe to correct")
+	fmt.Println("  --lint_rules <rules> : comma separated rules to check, like default,-unknown-field,empty-body")
+	fmt.Println("    all and default select all rules or the default rules, and a leading - turns a rule off.")
+	for _, rule := range webnotes.LintRules {
+		note := ""
+		if !rule.Default {
+			note += ", not default"
+		}
+		if rule.CanFix() {
+			note += ", fixable"
+		}
+		fmt.Printf("    %s : %s (%s%s)\n", rule.Name, rule.Description, rule.Severity, note)
+	}
+	fmt.Println(" archive specifier:")
+	fmt.Println("  This specifies the directory WARC files are written to and read from.")
+	fmt.Println("  Fetched pages are archived by --add, --fill and --set when it is given.")
+	fmt.Println("  Defaults to " + webnotes.WARCPath + " for --archive and --http.")
+	fmt.Println("  --warc_dir <directory>")
+	fmt.Println(" fetch specifiers:")
+	fmt.Println("  These configure how urls are fetched.")
+	fmt.Println("  --cache_dir <directory> : caches responses in the directory")
+	fmt.Println("  --cache_only : only uses cached responses, never the network")
+	fmt.Println("  --cache_ttl <duration> : how long cached responses are used before revalidating, like 24h")
+	fmt.Println("    The cache is used if any cache option is given and defaults to " + webnotes.CachePath + ".")
+	fmt.Println("  --cookie_file <file> : cookies in Netscape cookies.txt format")
+	fmt.Println("  --headers_file <file> : lines of \"<host> <name>: <value>\" headers to send")
+	fmt.Println("  --host_interval <duration> : least time between requests to a host, like 1s")
+	fmt.Println("  --ignore_robots : fetches urls that robots.txt disallows")
+	fmt.Println("  --max_body_size <bytes> : largest response body to read")
+	fmt.Println("  --own_hosts <hosts> : comma separated hosts that are not checked against robots.txt or rate limited")
+	fmt.Println("  --proxy <url> : proxy to use instead of the environment's proxy")
+	fmt.Println("  --timeout <duration> : time limit for requests, like 30s")
+	fmt.Println("  --user_agent <string> : User-Agent header to send")
 }
 
 func main() {
@@ -664,16 +1213,39 @@ func main() {
 	defer func() {
 		os.Exit(code)
 	}()
-	o := getOptions()
+	var o *options
 	var mainFunc func(*options) error
-	for k, v := range mainFuncs {
-		if o.b[k] {
-			if mainFunc != nil {
-				fmt.Println("Only one main option allowed")
-				code = 1
-				return
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		var err error
+		o, mainFunc, err = parseCommand(os.Args[1:])
+		if err == errHelp {
+			return
+		} else if err == errUsage {
+			code = 2
+			return
+		} else if err != nil {
+			fmt.Println(err)
+			commandsUsage()
+			code = 2
+			return
+		}
+	} else {
+		// the older form, like webnotes --add, where every flag is accepted by every command
+		o = getOptions()
+		if o.b["format"] && flag.NArg() > 0 && slices.Contains(outputFormats, flag.Arg(0)) {
+			fmt.Printf("--format %s runs the format command, use --format=%s to choose the output format\n", flag.Arg(0), flag.Arg(0))
+			code = 2
+			return
+		}
+		for k, v := range mainFuncs {
+			if o.b[k] {
+				if mainFunc != nil {
+					fmt.Println("Only one main option allowed")
+					code = 1
+					return
+				}
+				mainFunc = v
 			}
-			mainFunc = v
 		}
 	}
 	if mainFunc == nil {
@@ -681,16 +1253,36 @@ func main() {
 		code = 1
 		return
 	} else {
-		err := mainFunc(o)
+		err := o.applyConfig()
+		if err != nil {
+			fmt.Println(err)
+			code = 1
+			return
+		}
+		err = o.setupFetcher()
 		if err != nil {
 			fmt.Println(err)
 			code = 1
 			return
 		}
+		err = mainFunc(o)
+		if err == errSilent {
+			code = 1
+			return
+		} else if err != nil {
+			fmt.Println(err)
+			code = 1
+			return
+		}
 	}
 }
 
 func mainAdd(o *options) error {
+	closeWARC, err := o.startWARC(false)
+	if err != nil {
+		return err
+	}
+	defer closeWARC()
 	out, err := o.outWebNotesFile()
 	if err != nil {
 		return err
@@ -719,11 +1311,17 @@ func mainAdd(o *options) error {
 	if o.s["vbody"] != "" {
 		section.SetBody([]string{o.s["vbody"]})
 	}
-	tags, err := webnotes.GetTags(o.s["vtags"])
+	tags, err := o.valueTags()
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 && o.config != nil {
+		tags = o.config.DefaultTags
+	}
+	err = section.SetTags(tags)
 	if err != nil {
 		return err
 	}
-	section.SetTags(tags)
 	if o.hasGetSpecifier() {
 		if section.URL != "" {
 			doc, err := section.Get()
@@ -839,6 +1437,111 @@ func mainCombine(o *options) error {
 	return nil
 }
 
+func mainArchive(o *options) error {
+	fps, err := o.matchingFiles()
+	if err != nil {
+		return err
+	}
+	sm, err := o.sectionMatcher()
+	if err != nil {
+		return err
+	}
+	closeWARC, err := o.startWARC(true)
+	if err != nil {
+		return err
+	}
+	defer closeWARC()
+	failed := 0
+	for _, fp := range fps {
+		wn, indexes, err := sm.matchingSections(fp)
+		if err != nil {
+			return err
+		}
+		for _, i := range indexes {
+			sct := wn.Sections[i]
+			if sct.URL == "" {
+				continue
+			}
+			// the url is fetched without Section.Get so the webnote is not changed
+			resp, _, err := webnotes.DefaultFetcher.Get(sct.URL)
+			if errors.Is(err, webnotes.ErrWARCWrite) {
+				return err
+			} else if err == nil && resp.StatusCode != 200 {
+				err = errors.New(resp.Status)
+			}
+			if err != nil {
+				fmt.Printf("%s: %s: %s\n", sectionLocation(wn, sct), sct.URL, err)
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return errors.New(fmt.Sprintf("Failed to archive %d urls", failed))
+	}
+	return nil
+}
+
+// loadInvalidTags loads a webnote file that can have invalid tags, so clean_tags can fix them.
+// Returns (*WebNote, nil) on success.
+// Returns (nil, error) if the file can not be read or has errors other than invalid tags.
+func loadInvalidTags(filePath string) (*webnotes.WebNote, error) {
+	wn, diagnostics, err := webnotes.ParseWebNote(filePath)
+	if err != nil {
+		return nil, err
+	}
+	// each invalid tag is one error, any other error means lines of the file were skipped
+	invalid := 0
+	for _, sct := range wn.Sections {
+		tags, _ := sct.FieldValues("tags")
+		for _, tag := range tags {
+			if webnotes.ValidateTag(tag) != nil {
+				invalid++
+			}
+		}
+	}
+	errs := []string{}
+	for _, d := range diagnostics {
+		if d.Severity == webnotes.SeverityError {
+			errs = append(errs, d.String())
+		}
+	}
+	if len(errs) != invalid {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+	return wn, nil
+}
+
+func mainCleanTags(o *options) error {
+	return o.changeTags(loadInvalidTags, func(sct *webnotes.Section) (bool, error) {
+		tags, ok := sct.FieldValues("tags")
+		if !ok {
+			return false, nil
+		}
+		id, err := sct.ID()
+		if err != nil {
+			return false, err
+		}
+		cleaned := []string{}
+		for _, tag := range tags {
+			if webnotes.ValidateTag(tag) == nil {
+				cleaned = append(cleaned, tag)
+				continue
+			}
+			if clean := webnotes.CleanTag(tag); clean != "" {
+				fmt.Printf("%s: %q -> %q\n", id, tag, clean)
+				cleaned = append(cleaned, clean)
+			} else {
+				fmt.Printf("%s: %q removed\n", id, tag)
+			}
+		}
+		cleaned = webnotes.ResolveTags(cleaned)
+		if slices.Equal(tags, cleaned) {
+			return false, nil
+		}
+		return true, sct.SetTags(cleaned)
+	})
+}
+
 func mainClear(o *options) error {
 	fps, err := o.matchingFiles()
 	if err != nil {
@@ -945,34 +1648,74 @@ func mainDuplicates(o *options) error {
 	if err != nil {
 		return err
 	}
+	w, err := o.recordWriter(duplicateColumns)
+	if err != nil {
+		return err
+	}
+	// sections with the same canonical id are duplicates, the id of the first one is printed
 	ids := make(map[string][]string)
+	names := make(map[string]string)
+	locations := make(map[string][]string)
 	for _, fp := range fps {
 		wn, indexes, err := sm.matchingSections(fp)
 		if err != nil {
 			return err
 		}
 		for _, i := range indexes {
-			id, err := wn.Sections[i].ID()
+			canonicalID, err := wn.Sections[i].CanonicalID()
 			if err != nil {
 				return err
 			}
-			_, ok := ids[id]
+			_, ok := ids[canonicalID]
 			if ok {
-				ids[id] = append(ids[id], fp)
+				ids[canonicalID] = append(ids[canonicalID], fp)
 			} else {
-				ids[id] = []string{fp}
+				ids[canonicalID] = []string{fp}
+				names[canonicalID], _ = wn.Sections[i].ID()
 			}
+			locations[canonicalID] = append(locations[canonicalID], sectionLocation(wn, wn.Sections[i]))
 		}
 	}
-	for id, files := range ids {
+	// sorted so the output is the same every time
+	canonicalIDs := []string{}
+	for canonicalID := range ids {
+		canonicalIDs = append(canonicalIDs, canonicalID)
+	}
+	sort.Strings(canonicalIDs)
+	for _, canonicalID := range canonicalIDs {
+		files := ids[canonicalID]
+		id := names[canonicalID]
 		if len(files) > 1 {
-			fmt.Println(strings.Join(files, ",") + ": " + id)
+			if w != nil {
+				r := &duplicateRecord{id, files, locations[canonicalID]}
+				err = w.write(r, r.row())
+				if err != nil {
+					return err
+				}
+			} else if o.b["locations"] {
+				for _, location := range locations[canonicalID] {
+					fmt.Println(location + ": " + id)
+				}
+			} else {
+				fmt.Println(strings.Join(files, ",") + ": " + id)
+			}
 		}
 	}
+	if w != nil {
+		return w.close()
+	}
 	return nil
 }
 
-func mainFill(o *options) error {
+// editedSection is where a section being edited came from.
+type editedSection struct {
+	wn    *webnotes.WebNote
+	index int
+	id    string
+	used  bool
+}
+
+func mainEdit(o *options) error {
 	fps, err := o.matchingFiles()
 	if err != nil {
 		return err
@@ -981,32 +1724,144 @@ func mainFill(o *options) error {
 	if err != nil {
 		return err
 	}
+	tmp, err := os.CreateTemp("", "webnotes-*.wn")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	edit := webnotes.NewWebNote(tmp.Name())
+	originals := []*editedSection{}
 	for _, fp := range fps {
 		wn, indexes, err := sm.matchingSections(fp)
 		if err != nil {
 			return err
 		}
 		for _, i := range indexes {
-			if o.b["date"] {
-				wn.Sections[i].FillDate()
-			}
-			for _, name := range valueSpecifiers {
-				v := "v" + name
-				if o.s[v] != "" {
-					wn.Sections[i].FillFieldValue(name, o.s[v])
-				}
+			id, err := wn.Sections[i].ID()
+			if err != nil {
+				return err
 			}
-			if o.s["vbody"] != "" {
+			originals = append(originals, &editedSection{wn, i, id, false})
+			edit.AddSection(wn.Sections[i])
+		}
+	}
+	if len(originals) == 0 {
+		os.Remove(tmp.Name())
+		return nil
+	}
+	if err := webnotes.SaveWebNote(edit); err != nil {
+		return err
+	}
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], tmp.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.New(fmt.Sprintf("Editor failed, edits are in %s: %s", tmp.Name(), err))
+	}
+	edited, diagnostics, err := webnotes.ParseWebNote(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if webnotes.HasErrors(diagnostics) {
+		for _, d := range diagnostics {
+			fmt.Println(d)
+		}
+		return errors.New(fmt.Sprintf("Edits not saved because of errors, they are in %s", tmp.Name()))
+	}
+	os.Remove(tmp.Name())
+	// each edited section replaces the first unused original section with the same id
+	// new sections go in the file of the section before them, after that section
+	placed := map[*webnotes.WebNote]map[int][]*webnotes.Section{}
+	for _, original := range originals {
+		if _, ok := placed[original.wn]; !ok {
+			placed[original.wn] = map[int][]*webnotes.Section{}
+		}
+		placed[original.wn][original.index] = []*webnotes.Section{}
+	}
+	anchor := originals[0]
+	for _, sct := range edited.Sections {
+		id, err := sct.ID()
+		if err != nil {
+			return err
+		}
+		for _, original := range originals {
+			if !original.used && original.id == id {
+				original.used = true
+				anchor = original
+				break
+			}
+		}
+		placed[anchor.wn][anchor.index] = append(placed[anchor.wn][anchor.index], sct)
+	}
+	for wn, sections := range placed {
+		changed := false
+		out := []*webnotes.Section{}
+		for i, sct := range wn.Sections {
+			replacements, ok := sections[i]
+			if !ok {
+				out = append(out, sct)
+				continue
+			}
+			if len(replacements) != 1 || replacements[0].String() != sct.String() {
+				changed = true
+			}
+			out = append(out, replacements...)
+		}
+		if changed {
+			wn.Sections = out
+			err = webnotes.SaveWebNote(wn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func mainFill(o *options) error {
+	closeWARC, err := o.startWARC(false)
+	if err != nil {
+		return err
+	}
+	defer closeWARC()
+	fps, err := o.matchingFiles()
+	if err != nil {
+		return err
+	}
+	sm, err := o.sectionMatcher()
+	if err != nil {
+		return err
+	}
+	tags, err := o.valueTags()
+	if err != nil {
+		return err
+	}
+	for _, fp := range fps {
+		wn, indexes, err := sm.matchingSections(fp)
+		if err != nil {
+			return err
+		}
+		for _, i := range indexes {
+			if o.b["date"] {
+				wn.Sections[i].FillDate()
+			}
+			for _, name := range valueSpecifiers {
+				v := "v" + name
+				if o.s[v] != "" {
+					wn.Sections[i].FillFieldValue(name, o.s[v])
+				}
+			}
+			if o.s["vbody"] != "" {
 				wn.Sections[i].FillBody([]string{o.s["vbody"]})
 			}
 			if o.s["vtags"] != "" {
-				tags, err := webnotes.GetTags(o.s["vtags"])
+				err = wn.Sections[i].AddTags(tags)
 				if err != nil {
 					return err
 				}
-				for _, tag := range tags {
-					wn.Sections[i].AddTag(tag)
-				}
 			}
 			if o.hasGetSpecifier() {
 				if wn.Sections[i].URL != "" {
@@ -1094,11 +1949,110 @@ func mainHttp(o *options) error {
 		return err
 	}
 	http.Handle("/", httpHandler)
-	return http.ListenAndServe(":8080", nil)
+	address := o.s["http_address"]
+	if address == "" {
+		address = ":8080"
+	}
+	return http.ListenAndServe(address, nil)
 }
 
 func mainIndex(o *options) error {
-	return webnotes.BuildIndex()
+	skipped, err := webnotes.BuildIndex()
+	if err != nil {
+		return err
+	}
+	files := []string{}
+	for _, d := range skipped {
+		fmt.Println(d)
+		if !slices.Contains(files, d.FilePath) {
+			files = append(files, d.FilePath)
+		}
+	}
+	if len(files) > 0 {
+		fmt.Printf("Skipped %d files with errors: %s\n", len(files), strings.Join(files, ", "))
+	}
+	return nil
+}
+
+func mainLint(o *options) error {
+	rules, err := webnotes.ParseLintRules(o.s["lint_rules"])
+	if err != nil {
+		return err
+	}
+	fps, err := o.matchingFiles()
+	if err != nil {
+		return err
+	}
+	// links can point to any file, not only the matching ones
+	allFps, err := webnotes.GetWebNoteFiles(".")
+	if err != nil {
+		return err
+	}
+	linter := webnotes.NewLinter(rules)
+	for _, fp := range allFps {
+		wn, _, err := webnotes.ParseWebNote(fp)
+		if err != nil {
+			return err
+		}
+		linter.AddNotes(wn)
+	}
+	w, err := o.recordWriter(diagnosticColumns)
+	if err != nil {
+		return err
+	}
+	errorCount := 0
+	for _, fp := range fps {
+		wn, diagnostics, err := webnotes.ParseWebNote(fp)
+		if err != nil {
+			return err
+		}
+		// fixes are only saved for files that parse without errors so no lines are lost
+		fix := o.b["fix"] && !webnotes.HasErrors(diagnostics)
+		ruleDiagnostics, changed := linter.Lint(wn, fix)
+		diagnostics = append(diagnostics, ruleDiagnostics...)
+		if changed {
+			err = webnotes.SaveWebNote(wn)
+			if err != nil {
+				return err
+			}
+			// lint the saved file again so the lines in the diagnostics are right
+			wn, diagnostics, err = webnotes.ParseWebNote(fp)
+			if err != nil {
+				return err
+			}
+			ruleDiagnostics, _ = linter.Lint(wn, false)
+			diagnostics = append(diagnostics, ruleDiagnostics...)
+		}
+		for _, d := range diagnostics {
+			if w != nil {
+				r := newDiagnosticRecord(d)
+				err = w.write(r, r.row())
+				if err != nil {
+					return err
+				}
+			} else {
+				fmt.Println(d)
+			}
+			if d.Severity == webnotes.SeverityError {
+				errorCount++
+			}
+		}
+	}
+	if w != nil {
+		err = w.close()
+		if err != nil {
+			return err
+		}
+		// nothing else is printed so the output can be parsed
+		if errorCount > 0 {
+			return errSilent
+		}
+		return nil
+	}
+	if errorCount > 0 {
+		return errors.New(fmt.Sprintf("Found %d errors", errorCount))
+	}
+	return nil
 }
 
 func mainMatches(o *options) error {
@@ -1110,13 +2064,123 @@ func mainMatches(o *options) error {
 	if err != nil {
 		return err
 	}
+	w, err := o.recordWriter(sectionColumns)
+	if err != nil {
+		return err
+	}
 	for _, fp := range fps {
 		wn, indexes, err := sm.matchingSections(fp)
 		if err != nil {
 			return err
 		}
 		for _, i := range indexes {
-			fmt.Println(wn.Sections[i])
+			if w != nil {
+				r, err := newSectionRecord(wn, wn.Sections[i])
+				if err != nil {
+					return err
+				}
+				err = w.write(r, r.row())
+				if err != nil {
+					return err
+				}
+			} else if o.b["locations"] {
+				sct := wn.Sections[i]
+				id, err := sct.ID()
+				if err != nil {
+					return err
+				}
+				if lines := wn.SectionLines(sct); lines != nil {
+					fmt.Printf("%s: %s (lines %d-%d)\n", sectionLocation(wn, sct), id, lines.Section.Start, lines.Section.End)
+				} else {
+					fmt.Printf("%s: %s\n", sectionLocation(wn, sct), id)
+				}
+			} else {
+				fmt.Println(wn.Sections[i])
+			}
+		}
+	}
+	if w != nil {
+		return w.close()
+	}
+	return nil
+}
+
+// sectionLocation returns where a section is in a file like "Links.wn:12".
+// Editors and grep-style tools can jump to locations in this format.
+func sectionLocation(wn *webnotes.WebNote, sct *webnotes.Section) string {
+	lines := wn.SectionLines(sct)
+	if lines == nil {
+		return wn.FilePath
+	}
+	return fmt.Sprintf("%s:%d", wn.FilePath, lines.Section.Start)
+}
+
+func mainMerge(o *options) error {
+	priority := []string{}
+	if o.s["priority"] != "" {
+		priority = strings.Split(o.s["priority"], ",")
+	}
+	home := o.s["home"]
+	if home == "" && len(priority) > 0 {
+		home = webnotes.MergeHomePriority
+	}
+	merger, err := webnotes.NewMerger(home, priority)
+	if err != nil {
+		return err
+	}
+	fps, err := o.matchingFiles()
+	if err != nil {
+		return err
+	}
+	// links can be in any file, not only the matching ones
+	allFps, err := webnotes.GetWebNoteFiles(".")
+	if err != nil {
+		return err
+	}
+	loaded := make(map[string]*webnotes.WebNote)
+	wns := []*webnotes.WebNote{}
+	for _, fp := range fps {
+		wn, err := webnotes.LoadWebNote(fp)
+		if err != nil {
+			return err
+		}
+		loaded[filepath.Clean(fp)] = wn
+		wns = append(wns, wn)
+	}
+	merges, moves, err := merger.Merge(wns)
+	if err != nil {
+		return err
+	}
+	changed := make(map[*webnotes.WebNote]bool)
+	for _, m := range merges {
+		fmt.Printf("%s: %s <- %s\n", sectionLocation(m.WebNote, m.Section), m.ID, strings.Join(m.Files, ","))
+		changed[m.WebNote] = true
+		for _, fp := range m.Files {
+			changed[loaded[filepath.Clean(fp)]] = true
+		}
+	}
+	if len(moves) > 0 {
+		for _, fp := range allFps {
+			wn, ok := loaded[filepath.Clean(fp)]
+			if !ok {
+				wn, err = webnotes.LoadWebNote(fp)
+				if err != nil {
+					return err
+				}
+				wns = append(wns, wn)
+			}
+			if count := webnotes.RewriteNoteLinks(wn, moves); count > 0 {
+				fmt.Printf("%s: %d links changed\n", fp, count)
+				changed[wn] = true
+			}
+		}
+	}
+	for _, wn := range wns {
+		if changed[wn] {
+			err = webnotes.SaveWebNote(wn)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -1159,6 +2223,11 @@ func mainMove(o *options) error {
 }
 
 func mainSet(o *options) error {
+	closeWARC, err := o.startWARC(false)
+	if err != nil {
+		return err
+	}
+	defer closeWARC()
 	fps, err := o.matchingFiles()
 	if err != nil {
 		return err
@@ -1167,6 +2236,10 @@ func mainSet(o *options) error {
 	if err != nil {
 		return err
 	}
+	tags, err := o.valueTags()
+	if err != nil {
+		return err
+	}
 	for _, fp := range fps {
 		wn, indexes, err := sm.matchingSections(fp)
 		if err != nil {
@@ -1186,10 +2259,6 @@ func mainSet(o *options) error {
 				wn.Sections[i].SetBody([]string{o.s["vbody"]})
 			}
 			if o.s["vtags"] != "" {
-				tags, err := webnotes.GetTags(o.s["vtags"])
-				if err != nil {
-					return err
-				}
 				wn.Sections[i].SetField("tags", tags)
 			}
 			if o.hasGetSpecifier() {
@@ -1225,6 +2294,130 @@ func mainSet(o *options) error {
 	return nil
 }
 
+func mainNormalizeTags(o *options) error {
+	if webnotes.Vocabulary == nil {
+		return errors.New("There is no tag vocabulary, set tag_vocabulary in " + webnotes.ConfigFileName)
+	}
+	return o.changeTags(webnotes.LoadWebNote, func(sct *webnotes.Section) (bool, error) {
+		tags, ok := sct.FieldValues("tags")
+		if !ok {
+			return false, nil
+		}
+		resolved := webnotes.ResolveTags(tags)
+		if slices.Equal(tags, resolved) {
+			return false, nil
+		}
+		return true, sct.SetTags(resolved)
+	})
+}
+
+func mainNormalizeUrls(o *options) error {
+	fps, err := o.matchingFiles()
+	if err != nil {
+		return err
+	}
+	sm, err := o.sectionMatcher()
+	if err != nil {
+		return err
+	}
+	for _, fp := range fps {
+		wn, indexes, err := sm.matchingSections(fp)
+		if err != nil {
+			return err
+		}
+		changed := false
+		for _, i := range indexes {
+			sct := wn.Sections[i]
+			if sct.URL == "" {
+				continue
+			}
+			normalized := webnotes.Canonicalizer.Normalize(sct.URL)
+			if normalized != sct.URL {
+				fmt.Printf("%s: %s -> %s\n", sectionLocation(wn, sct), sct.URL, normalized)
+				sct.URL = normalized
+				changed = true
+			}
+		}
+		if changed {
+			err = webnotes.SaveWebNote(wn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// threshold returns the --threshold value, or the default provided if it is not set.
+// Returns (threshold, nil) on success.
+// Returns (0, error) if the value is not a number more than 0 and at most 1.
+func (o *options) threshold(defaultThreshold float64) (float64, error) {
+	if o.s["threshold"] == "" {
+		return defaultThreshold, nil
+	}
+	threshold, err := strconv.ParseFloat(o.s["threshold"], 64)
+	if err != nil || threshold <= 0 || threshold > 1 {
+		return 0, errors.New(fmt.Sprintf("Invalid threshold: %s, must be more than 0 and at most 1", o.s["threshold"]))
+	}
+	return threshold, nil
+}
+
+func mainSimilar(o *options) error {
+	threshold, err := o.threshold(0.8)
+	if err != nil {
+		return err
+	}
+	fps, err := o.matchingFiles()
+	if err != nil {
+		return err
+	}
+	sm, err := o.sectionMatcher()
+	if err != nil {
+		return err
+	}
+	w, err := o.recordWriter(similarColumns)
+	if err != nil {
+		return err
+	}
+	finder := webnotes.NewSimilarityFinder(threshold)
+	for _, fp := range fps {
+		wn, indexes, err := sm.matchingSections(fp)
+		if err != nil {
+			return err
+		}
+		for _, i := range indexes {
+			finder.Add(wn, wn.Sections[i])
+		}
+	}
+	for n, cluster := range finder.Clusters() {
+		if w == nil {
+			fmt.Printf("similarity %.2f:\n", cluster.Similarity)
+		}
+		for _, s := range cluster.Sections {
+			id, err := s.Section.ID()
+			if err != nil {
+				return err
+			}
+			if w == nil {
+				fmt.Printf("  %s: %s\n", sectionLocation(s.WebNote, s.Section), id)
+				continue
+			}
+			r := &similarRecord{n + 1, cluster.Similarity, s.WebNote.FilePath, 0, id}
+			if lines := s.WebNote.SectionLines(s.Section); lines != nil {
+				r.Line = lines.Section.Start
+			}
+			err = w.write(r, r.row())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if w != nil {
+		return w.close()
+	}
+	return nil
+}
+
 func mainSort(o *options) error {
 	fps, err := o.matchingFiles()
 	if err != nil {
@@ -1244,6 +2437,255 @@ func mainSort(o *options) error {
 	return nil
 }
 
+func mainSuggestTags(o *options) error {
+	threshold, err := o.threshold(webnotes.DefaultSuggestionConfidence)
+	if err != nil {
+		return err
+	}
+	fps, err := o.matchingFiles()
+	if err != nil {
+		return err
+	}
+	sm, err := o.sectionMatcher()
+	if err != nil {
+		return err
+	}
+	w, err := o.recordWriter(suggestionColumns)
+	if err != nil {
+		return err
+	}
+	if w != nil && o.b["apply"] {
+		return errors.New("--apply prints the files changed, it can not be used with --format or --template")
+	}
+	// every file is the corpus, not only the matching ones
+	suggester, err := newTagSuggester()
+	if err != nil {
+		return err
+	}
+	for _, fp := range fps {
+		wn, indexes, err := sm.matchingSections(fp)
+		if err != nil {
+			return err
+		}
+		count := 0
+		for _, i := range indexes {
+			sct := wn.Sections[i]
+			suggestions := []*webnotes.TagSuggestion{}
+			tags := []string{}
+			for _, ts := range suggester.Suggest(wn, sct) {
+				if ts.Confidence < threshold {
+					break
+				}
+				suggestions = append(suggestions, ts)
+				tags = append(tags, ts.Tag)
+			}
+			if len(tags) == 0 {
+				continue
+			}
+			if o.b["apply"] {
+				err = sct.AddTags(tags)
+				if err != nil {
+					return errors.New(fmt.Sprintf("%s: %s", sectionLocation(wn, sct), err))
+				}
+				count++
+				continue
+			}
+			id, err := sct.ID()
+			if err != nil {
+				return err
+			}
+			if w == nil {
+				fmt.Printf("%s: %s\n", sectionLocation(wn, sct), id)
+				for _, ts := range suggestions {
+					fmt.Printf("  %.2f %s (%s)\n", ts.Confidence, ts.Tag, strings.Join(ts.Sources, ", "))
+				}
+				continue
+			}
+			for _, ts := range suggestions {
+				r := &suggestionRecord{wn.FilePath, 0, id, ts.Tag, ts.Confidence, ts.Sources}
+				if lines := wn.SectionLines(sct); lines != nil {
+					r.Line = lines.Section.Start
+				}
+				err = w.write(r, r.row())
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if count > 0 {
+			err = webnotes.SaveWebNote(wn)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: %d sections changed\n", fp, count)
+		}
+	}
+	if w != nil {
+		return w.close()
+	}
+	return nil
+}
+
+// newTagSuggester returns a TagSuggester with every webnote in the workspace as its corpus.
+// Files with errors are left out of the corpus.
+// Returns (*webnotes.TagSuggester, nil) on success.
+// Returns (nil, error) if a webnote file cannot be loaded.
+func newTagSuggester() (*webnotes.TagSuggester, error) {
+	fps, err := webnotes.GetWebNoteFiles(".")
+	if err != nil {
+		return nil, err
+	}
+	suggester := webnotes.NewTagSuggester()
+	for _, fp := range fps {
+		wn, diagnostics, err := webnotes.ParseWebNote(fp)
+		if err != nil {
+			return nil, err
+		}
+		if webnotes.HasErrors(diagnostics) {
+			continue
+		}
+		for _, sct := range wn.Sections {
+			suggester.Add(wn, sct)
+		}
+	}
+	return suggester, nil
+}
+
+// valueTags returns the tags of --vtags with aliases resolved.
+// Tags that are not in the tag vocabulary are warned about or rejected, as unknown_tags in the configuration says.
+// Returns ([]tags, nil) on success.
+// Returns (nil, error) if the tags are invalid or unknown tags are rejected.
+func (o *options) valueTags() ([]string, error) {
+	return o.knownTags(o.s["vtags"])
+}
+
+// knownTags returns the tags of a tag string with aliases resolved,
+// checking them against the tag vocabulary like valueTags.
+// Returns ([]tags, nil) on success.
+// Returns (nil, error) if the tags are invalid or unknown tags are rejected.
+func (o *options) knownTags(tagsString string) ([]string, error) {
+	tags, err := webnotes.GetTags(tagsString)
+	if err != nil {
+		return nil, err
+	}
+	if webnotes.Vocabulary == nil || o.config == nil {
+		return tags, nil
+	}
+	unknown := webnotes.Vocabulary.Unknown(tags)
+	if len(unknown) == 0 {
+		return tags, nil
+	}
+	switch o.config.UnknownTags {
+	case webnotes.UnknownTagsReject:
+		return nil, errors.New(fmt.Sprintf("Tags not in the tag vocabulary: %s", strings.Join(unknown, ",")))
+	case webnotes.UnknownTagsWarn:
+		fmt.Printf("Warning: tags not in the tag vocabulary: %s\n", strings.Join(unknown, ","))
+	}
+	return tags, nil
+}
+
+// changeTags calls change on each matching section and saves the files with changed sections.
+// The files are loaded with load, which is LoadWebNote unless invalid tags are being fixed.
+// change returns true if it changed the section.
+// The number of sections changed in each file is printed.
+func (o *options) changeTags(load func(filePath string) (*webnotes.WebNote, error), change func(sct *webnotes.Section) (bool, error)) error {
+	fps, err := o.matchingFiles()
+	if err != nil {
+		return err
+	}
+	sm, err := o.sectionMatcher()
+	if err != nil {
+		return err
+	}
+	for _, fp := range fps {
+		wn, err := load(fp)
+		if err != nil {
+			return err
+		}
+		count := 0
+		for _, sct := range wn.Sections {
+			if !sm.matches(sct) {
+				continue
+			}
+			changed, err := change(sct)
+			if err != nil {
+				return errors.New(fmt.Sprintf("%s: %s", sectionLocation(wn, sct), err))
+			}
+			if changed {
+				count++
+			}
+		}
+		if count > 0 {
+			err = webnotes.SaveWebNote(wn)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: %d sections changed\n", fp, count)
+		}
+	}
+	return nil
+}
+
+// tagMapping returns the tags on the left and the tag on the right of a value like "a,b=c".
+// The tag on the right is checked against the tag vocabulary like valueTags.
+// Returns (from, to, nil) on success.
+// Returns (nil, "", error) if the value is invalid or its new tag is rejected.
+func (o *options) tagMapping(value string) ([]string, string, error) {
+	left, right, ok := strings.Cut(value, "=")
+	if !ok {
+		return nil, "", errors.New(fmt.Sprintf("Tags must be like old=new: %s", value))
+	}
+	// the old tags are not resolved so aliases can be renamed
+	from, err := webnotes.SplitTags(left)
+	if err != nil {
+		return nil, "", err
+	}
+	to, err := o.knownTags(right)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(from) == 0 || len(to) != 1 {
+		return nil, "", errors.New(fmt.Sprintf("Tags must be like old=new: %s", value))
+	}
+	return from, to[0], nil
+}
+
+func mainMergeTags(o *options) error {
+	from, to, err := o.tagMapping(o.s["merge_tags"])
+	if err != nil {
+		return err
+	}
+	return o.changeTags(webnotes.LoadWebNote, func(sct *webnotes.Section) (bool, error) { return sct.RenameTags(from, to) })
+}
+
+func mainRetag(o *options) error {
+	from, to, err := o.tagMapping(o.s["retag"])
+	if err != nil {
+		return err
+	}
+	if len(from) != 1 {
+		return errors.New(fmt.Sprintf("Only one tag can be renamed, use merge_tags for more: %s", o.s["retag"]))
+	}
+	return o.changeTags(webnotes.LoadWebNote, func(sct *webnotes.Section) (bool, error) { return sct.RenameTags(from, to) })
+}
+
+func mainUntag(o *options) error {
+	tags, err := webnotes.SplitTags(o.s["vtags"])
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return errors.New("The tags to remove must be given with --vtags")
+	}
+	return o.changeTags(webnotes.LoadWebNote, func(sct *webnotes.Section) (bool, error) {
+		if !sct.FieldHasValue("tags", tags) {
+			return false, nil
+		}
+		sct.DeleteTags(tags)
+		return true, nil
+	})
+}
+
 func mainTag(o *options) error {
 	fps, err := o.matchingFiles()
 	if err != nil {
@@ -1253,17 +2695,20 @@ func mainTag(o *options) error {
 	if err != nil {
 		return err
 	}
+	tags, err := o.valueTags()
+	if err != nil {
+		return err
+	}
 	for _, fp := range fps {
 		wn, indexes, err := sm.matchingSections(fp)
 		if err != nil {
 			return err
 		}
 		for _, i := range indexes {
-			tags, err := webnotes.GetTags(o.s["vtags"])
+			err = wn.Sections[i].AddTags(tags)
 			if err != nil {
 				return err
 			}
-			wn.Sections[i].AddTags(tags)
 		}
 		if len(indexes) > 0 {
 			err = webnotes.SaveWebNote(wn)
@@ -3,8 +3,15 @@ module github.com/greglange/webnotes
 go 1.21.1
 
 require (
-	github.com/PuerkitoBio/goquery v1.9.1 // indirect
+	github.com/BurntSushi/toml v1.3.2
+	github.com/PuerkitoBio/goquery v1.9.1
+	github.com/gomarkdown/markdown v0.0.0-20240328165702-4d01890c35c0
+	golang.org/x/net v0.21.0
+	golang.org/x/term v0.17.0
+	golang.org/x/text v0.14.0
+)
+
+require (
 	github.com/andybalholm/cascadia v1.3.2 // indirect
-	github.com/gomarkdown/markdown v0.0.0-20240328165702-4d01890c35c0 // indirect
-	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
 )
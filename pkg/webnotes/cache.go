@@ -0,0 +1,106 @@
+package webnotes
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const CachePath string = "wn_cache"
+
+// ErrNotCached is returned by Fetcher.Get for urls not in the cache when the cache is in only mode.
+var ErrNotCached = errors.New("Url is not in the cache")
+
+// Struct for an on-disk HTTP response cache.
+// Responses are stored one per file, named by the MD5 of the url.
+// The modification time of a file is when the response was last validated.
+// Responses older than TTL are revalidated with ETag and Last-Modified.
+// If Only is true, the network is never used.
+type HTTPCache struct {
+	Dir  string
+	TTL  time.Duration
+	Only bool
+}
+
+// NewHTTPCache returns an initialized HTTPCache.
+func NewHTTPCache(dir string, ttl time.Duration) *HTTPCache {
+	return &HTTPCache{dir, ttl, false}
+}
+
+// filePath returns the path of the cache file for the url.
+func (c *HTTPCache) filePath(rawURL string) string {
+	return filepath.Join(c.Dir, fmt.Sprintf("%x", md5.Sum([]byte(rawURL))))
+}
+
+// Load loads the cached response for the url.
+// Returns (*http.Response, body, fresh, nil) if the url is cached.
+// fresh is false if the response is older than the TTL.
+// Returns (nil, nil, false, nil) if the url is not cached.
+// Returns (nil, nil, false, error) on failure.
+func (c *HTTPCache) Load(rawURL string) (*http.Response, []byte, bool, error) {
+	filePath := c.filePath(rawURL)
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, false, nil
+		}
+		return nil, nil, false, err
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	fresh := time.Since(stat.ModTime()) < c.TTL
+	return resp, body, fresh, nil
+}
+
+// Store stores the response for the url in the cache.
+// Only responses with a 200 status code are stored.
+// Returns nil on success and error on failure.
+func (c *HTTPCache) Store(rawURL string, resp *http.Response, body []byte) error {
+	if resp.StatusCode != 200 {
+		return nil
+	}
+	if err := os.MkdirAll(c.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := rawResponse(resp, body).Write(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(c.filePath(rawURL), buf.Bytes(), 0644)
+}
+
+// Touch marks the cached response for the url as just validated.
+// Returns nil on success and error on failure.
+func (c *HTTPCache) Touch(rawURL string) error {
+	now := time.Now()
+	return os.Chtimes(c.filePath(rawURL), now, now)
+}
+
+// addValidators adds conditional request headers for a cached response to req.
+func addValidators(req *http.Request, cached *http.Response) {
+	if etag := cached.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
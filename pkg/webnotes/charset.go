@@ -0,0 +1,23 @@
+package webnotes
+
+import (
+	"golang.org/x/net/html/charset"
+)
+
+// ToUTF8 transcodes an HTML document to UTF-8.
+// The encoding is detected from a byte order mark, the Content-Type header,
+// and <meta charset> or <meta http-equiv> tags, in that order.
+// Documents with no detectable encoding are treated as Windows-1252, as browsers do.
+// Returns (utf8_body, encoding_name, nil) on success.
+// Returns (nil, "", error) on failure.
+func ToUTF8(body []byte, contentType string) ([]byte, string, error) {
+	encoding, name, _ := charset.DetermineEncoding(body, contentType)
+	if name == "utf-8" {
+		return body, name, nil
+	}
+	utf8Body, err := encoding.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, "", err
+	}
+	return utf8Body, name, nil
+}
@@ -0,0 +1,139 @@
+package webnotes
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ConfigFileName is the name of the webnotes configuration file.
+// The file is found by looking in the current directory and then in each directory above it.
+const ConfigFileName string = ".webnotes.toml"
+
+// Struct for a webnotes configuration file.
+// Root is the workspace root, where webnote files are searched for.
+// It is relative to the directory of the configuration file and defaults to that directory.
+// The other paths are relative to Root.
+// TagVocabulary is a TagVocabulary file and UnknownTags, one of the UnknownTags constants, defaults to warn.
+// URLs are the rules for comparing URLs and tracking_params defaults to DefaultTrackingParams.
+//
+// For example:
+//
+//	root = "notes"
+//	out_file = "Inbox.wn"
+//	index_path = "wn_index"
+//	http_address = "localhost:8080"
+//	default_tags = ["inbox"]
+//	tag_vocabulary = "tags.toml"
+//	unknown_tags = "warn"
+//
+//	[fetch]
+//	user_agent = "webnotes (me@example.com)"
+//	timeout = "30s"
+//	cache_dir = "wn_cache"
+//
+//	[urls]
+//	keep_www = true
+//	tracking_params = ["utm_*", "fbclid", "ref"]
+type Config struct {
+	FilePath      string           `toml:"-"`
+	Root          string           `toml:"root"`
+	OutFile       string           `toml:"out_file"`
+	IndexPath     string           `toml:"index_path"`
+	HTTPAddress   string           `toml:"http_address"`
+	DefaultTags   []string         `toml:"default_tags"`
+	TagVocabulary string           `toml:"tag_vocabulary"`
+	UnknownTags   string           `toml:"unknown_tags"`
+	Fetch         FetchConfig      `toml:"fetch"`
+	URLs          URLCanonicalizer `toml:"urls"`
+}
+
+// Struct for the fetch settings of a configuration file.
+// These are the defaults for the command line options with the same names.
+type FetchConfig struct {
+	CacheDir     string   `toml:"cache_dir"`
+	CacheOnly    bool     `toml:"cache_only"`
+	CacheTTL     string   `toml:"cache_ttl"`
+	CookieFile   string   `toml:"cookie_file"`
+	HeadersFile  string   `toml:"headers_file"`
+	HostInterval string   `toml:"host_interval"`
+	IgnoreRobots bool     `toml:"ignore_robots"`
+	MaxBodySize  int64    `toml:"max_body_size"`
+	OwnHosts     []string `toml:"own_hosts"`
+	Proxy        string   `toml:"proxy"`
+	Timeout      string   `toml:"timeout"`
+	UserAgent    string   `toml:"user_agent"`
+	WARCDir      string   `toml:"warc_dir"`
+}
+
+// FindConfig looks for a configuration file in dir and then in each directory above it.
+// Returns (*Config, nil) if a configuration file is found.
+// Returns (nil, nil) if there is no configuration file.
+// Returns (nil, error) if a configuration file cannot be loaded.
+func FindConfig(dir string) (*Config, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		filePath := filepath.Join(dir, ConfigFileName)
+		exists, err := FileExists(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return LoadConfig(filePath)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig loads a configuration file.
+// Root is made an absolute path.
+// Returns (*Config, nil) on success.
+// Returns (nil, error) if the file cannot be read or has unknown settings.
+func LoadConfig(filePath string) (*Config, error) {
+	config := &Config{}
+	md, err := toml.DecodeFile(filePath, config)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid configuration file %s: %s", filePath, err))
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := []string{}
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return nil, errors.New(fmt.Sprintf("Unknown settings in configuration file %s: %s", filePath, strings.Join(keys, ", ")))
+	}
+	config.FilePath = filePath
+	if config.UnknownTags == "" {
+		config.UnknownTags = UnknownTagsWarn
+	} else if !slices.Contains([]string{UnknownTagsAllow, UnknownTagsReject, UnknownTagsWarn}, config.UnknownTags) {
+		return nil, errors.New(fmt.Sprintf("Invalid unknown_tags in configuration file %s: %s, must be allow, reject or warn", filePath, config.UnknownTags))
+	}
+	if config.URLs.TrackingParams == nil {
+		config.URLs.TrackingParams = DefaultTrackingParams
+	}
+	dir, err := filepath.Abs(filepath.Dir(filePath))
+	if err != nil {
+		return nil, err
+	}
+	if config.Root == "" {
+		config.Root = dir
+	} else if !filepath.IsAbs(config.Root) {
+		config.Root = filepath.Join(dir, config.Root)
+	}
+	if stat, err := os.Stat(config.Root); err != nil || !stat.IsDir() {
+		return nil, errors.New(fmt.Sprintf("Root in configuration file %s is not a directory: %s", filePath, config.Root))
+	}
+	return config, nil
+}
@@ -0,0 +1,155 @@
+package webnotes
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Types of documents Section.Get understands.
+// Sections for urls that are not HTML documents get a type field with one of these values.
+const (
+	DocumentHTML  string = "html"
+	DocumentImage string = "image"
+	DocumentPDF   string = "pdf"
+	DocumentText  string = "text"
+)
+
+// DocumentType returns the type of a document from its Content-Type header.
+// If the header is missing or is application/octet-stream, the type is sniffed from the body.
+// Documents of unknown types are treated as HTML.
+// Returns (document_type, mime_type).
+func DocumentType(contentType string, body []byte) (string, string) {
+	mimeType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+	switch {
+	case mimeType == "text/html" || mimeType == "application/xhtml+xml":
+		return DocumentHTML, mimeType
+	case mimeType == "application/pdf":
+		return DocumentPDF, mimeType
+	case strings.HasPrefix(mimeType, "image/"):
+		return DocumentImage, mimeType
+	case strings.HasPrefix(mimeType, "text/"):
+		return DocumentText, mimeType
+	default:
+		return DocumentHTML, mimeType
+	}
+}
+
+// urlFileName returns the last element of the path of a url.
+// It is used as the title of documents that do not have one.
+func urlFileName(rawURL string) string {
+	url_, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(url_.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
+
+// textDocument returns an HTML document with the title and paragraphs provided.
+// Each paragraph is a slice of lines that are put in a <p></p> tag.
+// This lets the Content functions work on documents that are not HTML.
+func textDocument(title string, paragraphs [][]string) (*goquery.Document, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<html><head><title>%s</title></head><body>\n", html.EscapeString(title))
+	for i, paragraph := range paragraphs {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "<p>%s</p>\n", html.EscapeString(strings.Join(paragraph, "\n")))
+	}
+	b.WriteString("</body></html>")
+	return goquery.NewDocumentFromReader(strings.NewReader(b.String()))
+}
+
+// textParagraphs splits lines of plain text into paragraphs at blank lines.
+func textParagraphs(lines []string) [][]string {
+	paragraphs := [][]string{}
+	paragraph := []string{}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			if len(paragraph) > 0 {
+				paragraphs = append(paragraphs, paragraph)
+				paragraph = []string{}
+			}
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	if len(paragraph) > 0 {
+		paragraphs = append(paragraphs, paragraph)
+	}
+	return paragraphs
+}
+
+// htmlContent parses an HTML document.
+func (s *Section) htmlContent(body []byte, contentType string) (*goquery.Document, error) {
+	body, _, err := ToUTF8(body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	s.DeleteFields("type", "mime", "dimensions")
+	return goquery.NewDocumentFromReader(bytes.NewReader(body))
+}
+
+// pdfContent makes a document from the title and text of a PDF.
+// Each line of text becomes a paragraph.
+func (s *Section) pdfContent(body []byte) (*goquery.Document, error) {
+	title, lines := PDFContent(body)
+	if title == "" {
+		title = urlFileName(s.URL)
+	}
+	paragraphs := [][]string{}
+	for _, line := range lines {
+		paragraphs = append(paragraphs, []string{line})
+	}
+	s.SetFieldValue("type", DocumentPDF)
+	s.DeleteFields("mime", "dimensions")
+	return textDocument(title, paragraphs)
+}
+
+// textContent makes a document from plain text.
+// The text is kept as is, with paragraphs separated by blank lines.
+func (s *Section) textContent(body []byte, contentType string) (*goquery.Document, error) {
+	body, _, err := ToUTF8(body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.ReplaceAll(string(body), "\r\n", "\n")
+	s.SetFieldValue("type", DocumentText)
+	s.DeleteFields("mime", "dimensions")
+	return textDocument(urlFileName(s.URL), textParagraphs(strings.Split(text, "\n")))
+}
+
+// imageContent makes a document containing the image.
+// It records the MIME type and, for GIF, JPEG and PNG images, the dimensions of the image.
+func (s *Section) imageContent(body []byte, mimeType string) (*goquery.Document, error) {
+	s.SetFieldValue("type", DocumentImage)
+	s.SetFieldValue("mime", mimeType)
+	config, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err == nil {
+		s.SetFieldValue("dimensions", fmt.Sprintf("%dx%d", config.Width, config.Height))
+	} else {
+		s.DeleteField("dimensions")
+	}
+	page := fmt.Sprintf("<html><head><title>%s</title></head><body><img src=\"%s\"></body></html>",
+		html.EscapeString(urlFileName(s.URL)), html.EscapeString(s.URL))
+	return goquery.NewDocumentFromReader(strings.NewReader(page))
+}
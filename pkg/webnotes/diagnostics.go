@@ -0,0 +1,79 @@
+package webnotes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Severities of diagnostics.
+const (
+	SeverityError   string = "error"
+	SeverityWarning string = "warning"
+)
+
+// Struct for a problem found in a webnote file.
+// Line and Column start at 1.
+// Line and Column are 0 if the problem is not tied to a line.
+type Diagnostic struct {
+	FilePath string
+	Line     int
+	Column   int
+	Severity string
+	Message  string
+}
+
+// String returns the diagnostic in the format compilers use.
+// For example: "Links.wn:12:1: error: Invalid header line"
+func (d *Diagnostic) String() string {
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", d.FilePath, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.FilePath, d.Line, d.Column, d.Severity, d.Message)
+}
+
+// ParseWebNote loads a WebNote from the filePath provided without stopping at problems in the file.
+// Lines that can not be parsed are skipped and reported as diagnostics.
+// Invalid tags are reported as errors but are still loaded, so they can be fixed.
+// Returns (*WebNote, []*Diagnostic, nil) on success, even if there are error diagnostics.
+// Returns (nil, nil, error) if the file can not be read.
+func ParseWebNote(filePath string) (*WebNote, []*Diagnostic, error) {
+	return parseWebNote(filePath, true)
+}
+
+// HasErrors returns true if any of the diagnostics are errors.
+func HasErrors(diagnostics []*Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Struct for an error in a header value.
+// Offset is where in the value the error was found.
+type valueError struct {
+	message string
+	offset  int
+}
+
+func (e *valueError) Error() string {
+	return e.message
+}
+
+// headerValuePosition returns where an error from parseFieldValues is in a header line.
+// The value may span continuation lines, each of which started with a removed space.
+// Returns (lines_after_header_line, column).
+func headerValuePosition(name, value string, err error) (int, int) {
+	var ve *valueError
+	if !errors.As(err, &ve) {
+		return 0, 1
+	}
+	before := value[:min(ve.offset, len(value))]
+	line := strings.Count(before, "\n")
+	if line == 0 {
+		return 0, len(name) + len(": ") + len(before) + 1
+	}
+	return line, len(before) - strings.LastIndex(before, "\n") + 1
+}
@@ -0,0 +1,312 @@
+package webnotes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFetcher is the Fetcher used by Section.Get and Section.Head.
+var DefaultFetcher = NewFetcher()
+
+// Struct for configuring how webnotes fetches urls.
+// All network calls go through a Fetcher.
+// Transport can be set to a fake http.RoundTripper so fetching can be tested offline.
+// The http.Client is built on first use, so fields should be set before fetching.
+// If RobotsTxt is true, urls are checked against their host's robots.txt.
+// Requests to the same host are spaced at least MinInterval apart.
+// OwnHosts are hosts that are not checked against robots.txt or rate limited.
+type Fetcher struct {
+	UserAgent    string
+	Timeout      time.Duration
+	Proxy        string
+	Headers      map[string]http.Header
+	MaxBodySize  int64
+	CookieFile   string
+	Transport    http.RoundTripper
+	WARC         *WARCWriter
+	Cache        *HTTPCache
+	RobotsTxt    bool
+	MinInterval  time.Duration
+	OwnHosts     []string
+	client       *http.Client
+	robots       map[string]*RobotsRules
+	robotsErrors map[string]error
+	lastRequest  map[string]time.Time
+}
+
+// NewFetcher returns an initialized Fetcher.
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		UserAgent:   "webnotes",
+		Timeout:     30 * time.Second,
+		Headers:     make(map[string]http.Header),
+		MaxBodySize: 32 << 20,
+		RobotsTxt:   true,
+		MinInterval: time.Second,
+		OwnHosts:    make([]string, 0),
+	}
+}
+
+// Client returns the http.Client for the Fetcher.
+// Returns (*http.Client, nil) on success.
+// Returns (nil, error) if the proxy or cookie file are invalid.
+func (f *Fetcher) Client() (*http.Client, error) {
+	if f.client != nil {
+		return f.client, nil
+	}
+	transport := f.Transport
+	if transport == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		if f.Proxy != "" {
+			proxy, err := url.Parse(f.Proxy)
+			if err != nil {
+				return nil, err
+			}
+			t.Proxy = http.ProxyURL(proxy)
+		}
+		transport = t
+	}
+	client := &http.Client{Transport: transport, Timeout: f.Timeout}
+	if f.CookieFile != "" {
+		jar, err := LoadCookieFile(f.CookieFile)
+		if err != nil {
+			return nil, err
+		}
+		client.Jar = jar
+	}
+	f.client = client
+	return client, nil
+}
+
+// newRequest returns a request with the Fetcher's user agent and the headers for the url's host.
+func (f *Fetcher) newRequest(method, rawURL string) (*http.Request, error) {
+	req, err := http.NewRequest(method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	for name, values := range f.Headers[req.URL.Hostname()] {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return req, nil
+}
+
+// Get does a GET request for the url and reads the body of the response.
+// The body of the returned response has already been read and closed.
+// If Cache is set, fresh cached responses are returned without a request and
+// stale ones are revalidated.
+// The request and response are written to WARC if it is set, including responses from Cache,
+// so archiving with a cache archives every url.
+// Returns (*http.Response, body, nil) on success.
+// Returns (nil, nil, error) on failure.
+// A body larger than MaxBodySize is an error.
+// Returns (nil, nil, ErrDisallowed) if robots.txt does not allow the url.
+func (f *Fetcher) Get(rawURL string) (*http.Response, []byte, error) {
+	var cached *http.Response
+	var cachedBody []byte
+	if f.Cache != nil {
+		resp, body, fresh, err := f.Cache.Load(rawURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp != nil && (fresh || f.Cache.Only) {
+			if err := f.archiveCached(rawURL, resp, body); err != nil {
+				return nil, nil, err
+			}
+			return resp, body, nil
+		}
+		if f.Cache.Only {
+			return nil, nil, ErrNotCached
+		}
+		cached, cachedBody = resp, body
+	}
+	client, err := f.Client()
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := f.newRequest("GET", rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cached != nil {
+		addValidators(req, cached)
+	}
+	if err := f.politeness(req.URL, true); err != nil {
+		return nil, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		if err := f.Cache.Touch(rawURL); err != nil {
+			return nil, nil, err
+		}
+		if err := f.archiveCached(rawURL, cached, cachedBody); err != nil {
+			return nil, nil, err
+		}
+		return cached, cachedBody, nil
+	}
+	var reader io.Reader = resp.Body
+	if f.MaxBodySize > 0 {
+		reader = io.LimitReader(resp.Body, f.MaxBodySize+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.MaxBodySize > 0 && int64(len(body)) > f.MaxBodySize {
+		return nil, nil, errors.New(fmt.Sprintf("Response body is larger than %d bytes", f.MaxBodySize))
+	}
+	if err := f.archive(req, resp, body); err != nil {
+		return nil, nil, err
+	}
+	if f.Cache != nil {
+		if err := f.Cache.Store(rawURL, resp, body); err != nil {
+			return nil, nil, err
+		}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, body, nil
+}
+
+// archive writes an exchange to WARC if it is set.
+// Returns nil on success.
+// Returns an error wrapping ErrWARCWrite on failure.
+func (f *Fetcher) archive(req *http.Request, resp *http.Response, body []byte) error {
+	if f.WARC == nil {
+		return nil
+	}
+	if err := f.WARC.WriteExchange(req, resp, body); err != nil {
+		return fmt.Errorf("%w: %s", ErrWARCWrite, err)
+	}
+	return nil
+}
+
+// archiveCached writes a response from Cache to WARC if it is set,
+// with the request that would have fetched it without validators.
+// Returns nil on success.
+// Returns an error wrapping ErrWARCWrite on failure.
+func (f *Fetcher) archiveCached(rawURL string, resp *http.Response, body []byte) error {
+	if f.WARC == nil {
+		return nil
+	}
+	req, err := f.newRequest("GET", rawURL)
+	if err != nil {
+		return err
+	}
+	return f.archive(req, resp, body)
+}
+
+// Head does a HEAD request for the url.
+// Returns (*http.Response, nil) on success.
+// Returns (nil, error) on failure.
+// Returns (nil, ErrDisallowed) if robots.txt does not allow the url.
+func (f *Fetcher) Head(rawURL string) (*http.Response, error) {
+	client, err := f.Client()
+	if err != nil {
+		return nil, err
+	}
+	req, err := f.newRequest("HEAD", rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.politeness(req.URL, true); err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// LoadCookieFile loads cookies from a file in the Netscape cookies.txt format.
+// Returns (http.CookieJar, nil) on success.
+// Returns (nil, error) on failure.
+func LoadCookieFile(filePath string) (http.CookieJar, error) {
+	lines, err := LoadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range lines {
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) != 7 {
+			return nil, errorWithLineNumber(errors.New("Invalid cookie line"), i+1)
+		}
+		expires, err := strconv.ParseInt(parts[4], 10, 64)
+		if err != nil {
+			return nil, errorWithLineNumber(err, i+1)
+		}
+		secure := parts[3] == "TRUE"
+		host := strings.TrimPrefix(parts[0], ".")
+		cookie := &http.Cookie{Name: parts[5], Value: parts[6], Path: parts[2], Secure: secure}
+		if parts[1] == "TRUE" {
+			cookie.Domain = host
+		}
+		if expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+		scheme := "http"
+		if secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: parts[2]}, []*http.Cookie{cookie})
+	}
+	return jar, nil
+}
+
+// LoadHeadersFile loads per host request headers from a file.
+// Each line of the file is a host followed by a space and a header line.
+// For example: "example.com Authorization: Bearer token"
+// Returns (map[host]http.Header, nil) on success.
+// Returns (nil, error) on failure.
+func LoadHeadersFile(filePath string) (map[string]http.Header, error) {
+	lines, err := LoadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]http.Header)
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hostHeader := strings.SplitN(line, " ", 2)
+		if len(hostHeader) != 2 {
+			return nil, errorWithLineNumber(errors.New("Invalid header line"), i+1)
+		}
+		nameValue := strings.SplitN(hostHeader[1], ": ", 2)
+		if len(nameValue) != 2 {
+			return nil, errorWithLineNumber(errors.New("Invalid header line"), i+1)
+		}
+		host := hostHeader[0]
+		if _, ok := headers[host]; !ok {
+			headers[host] = make(http.Header)
+		}
+		headers[host].Add(nameValue[0], nameValue[1])
+	}
+	return headers, nil
+}
@@ -0,0 +1,378 @@
+package webnotes
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Struct for a lint rule.
+// Rules with a fix function can correct the problems they find.
+// check returns each problem found in a section.
+// fix corrects the problems in a section that are safe to correct and returns true if it changed the section.
+type LintRule struct {
+	Name        string
+	Description string
+	Severity    string
+	Default     bool
+	check       func(l *Linter, wn *WebNote, sct *Section) []*lintProblem
+	fix         func(l *Linter, wn *WebNote, sct *Section) bool
+}
+
+// Struct for a problem found by a lint rule.
+// Line is 0 if the section was not loaded from a file.
+type lintProblem struct {
+	line    int
+	message string
+}
+
+// sectionProblem returns a problem at the first line of a section.
+func sectionProblem(wn *WebNote, sct *Section, message string) *lintProblem {
+	lines := wn.SectionLines(sct)
+	if lines == nil {
+		return &lintProblem{0, message}
+	}
+	return &lintProblem{lines.Section.Start, message}
+}
+
+// fieldProblem returns a problem at the line of a section's field.
+func fieldProblem(wn *WebNote, sct *Section, name, message string) *lintProblem {
+	lines := wn.SectionLines(sct)
+	if lines == nil {
+		return &lintProblem{0, message}
+	}
+	if fieldLines, ok := lines.Fields[name]; ok {
+		return &lintProblem{fieldLines.Start, message}
+	}
+	return &lintProblem{lines.Section.Start, message}
+}
+
+// bodyProblem returns a problem at the line of sct.Body[i].
+func bodyProblem(wn *WebNote, sct *Section, i int, message string) *lintProblem {
+	lines := wn.SectionLines(sct)
+	if lines == nil || lines.Body.Start == 0 {
+		return sectionProblem(wn, sct, message)
+	}
+	first := slices.IndexFunc(sct.Body, func(line string) bool { return line != "" })
+	return &lintProblem{lines.Body.Start + i - first, message}
+}
+
+// CanFix returns true if the rule can correct the problems it finds.
+func (r *LintRule) CanFix() bool {
+	return r.fix != nil
+}
+
+// LintRules are all the lint rules, sorted by name.
+var LintRules = []*LintRule{
+	{"broken-link", "links to webnote notes that do not exist", SeverityError, true, checkBrokenLinks, nil},
+	{"date-format", "date fields that are not YYYY-MM-DD", SeverityWarning, true, checkDateFormat, fixDateFormat},
+	{"duplicate-note", "note sections with the same note in a file", SeverityError, true, checkDuplicateNote, fixDuplicateNote},
+	{"duplicate-url", "url sections with the same url in a file", SeverityWarning, true, checkDuplicateURL, fixDuplicateURL},
+	{"empty-body", "note sections without a body", SeverityWarning, false, checkEmptyBody, nil},
+	{"invalid-url", "urls that do not parse or are not http or https", SeverityError, true, checkInvalidURL, nil},
+	{"stale-status", "status and error fields that no longer apply", SeverityWarning, true, checkStaleStatus, fixStaleStatus},
+	{"unknown-field", "fields webnotes does not know about", SeverityWarning, true, checkUnknownField, nil},
+}
+
+// dateLayouts are the date formats the date-format rule knows how to fix.
+var dateLayouts = []string{
+	time.RFC3339, "2006-01-02 15:04:05", "2006/01/02", "2006-1-2", "2006/1/2",
+	"Jan 2, 2006", "January 2, 2006", "2 Jan 2006", "2 January 2006", "02 Jan 2006",
+}
+
+var webNoteLinkRegexp = regexp.MustCompile(`\]\(([^)\s]+\.wn)#([^)\s]+)\)`)
+
+// ParseLintRules returns the enabled rules from a comma separated list.
+// The list can name rules, "default" for the rules enabled by default, and "all" for all rules.
+// A rule name starting with - disables the rule.
+// For example: "default,-unknown-field,empty-body"
+// An empty list enables the default rules.
+// Returns ([]*LintRule, nil) on success.
+// Returns (nil, error) if an unknown rule is named.
+func ParseLintRules(list string) ([]*LintRule, error) {
+	if list == "" {
+		list = "default"
+	}
+	enabled := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		disable := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		switch name {
+		case "all":
+			for _, rule := range LintRules {
+				enabled[rule.Name] = !disable
+			}
+		case "default":
+			for _, rule := range LintRules {
+				if rule.Default {
+					enabled[rule.Name] = !disable
+				}
+			}
+		default:
+			if FindLintRule(name) == nil {
+				return nil, errors.New(fmt.Sprintf("Unknown lint rule: %s", name))
+			}
+			enabled[name] = !disable
+		}
+	}
+	rules := []*LintRule{}
+	for _, rule := range LintRules {
+		if enabled[rule.Name] {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// FindLintRule returns the lint rule with the name or nil if there is no such rule.
+func FindLintRule(name string) *LintRule {
+	for _, rule := range LintRules {
+		if rule.Name == name {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Struct for checking webnote files with lint rules.
+// Notes maps file paths to the notes in them and is used to check links.
+type Linter struct {
+	Rules []*LintRule
+	Notes map[string][]string
+}
+
+// NewLinter returns a Linter that checks the rules provided.
+func NewLinter(rules []*LintRule) *Linter {
+	return &Linter{rules, make(map[string][]string)}
+}
+
+// AddNotes records the notes in a WebNote so links to them can be checked.
+func (l *Linter) AddNotes(wn *WebNote) {
+	notes := []string{}
+	for _, sct := range wn.Sections {
+		if sct != nil && sct.Note != "" {
+			notes = append(notes, sct.Note)
+		}
+	}
+	l.Notes[filepath.Clean(wn.FilePath)] = notes
+}
+
+// Lint checks a WebNote with the Linter's rules.
+// If fix is true, problems that are safe to correct are corrected and are not returned.
+// Diagnostics are sorted by line.
+// Returns ([]*Diagnostic, changed) where changed is true if the WebNote was changed by fixes.
+func (l *Linter) Lint(wn *WebNote, fix bool) ([]*Diagnostic, bool) {
+	diagnostics := []*Diagnostic{}
+	changed := false
+	for _, rule := range l.Rules {
+		for _, sct := range wn.Sections {
+			if sct == nil {
+				continue
+			}
+			if fix && rule.fix != nil {
+				changed = rule.fix(l, wn, sct) || changed
+				if sct.removed() {
+					continue
+				}
+			}
+			for _, problem := range rule.check(l, wn, sct) {
+				id, _ := sct.ID()
+				column := 1
+				if problem.line == 0 {
+					column = 0
+				}
+				diagnostics = append(diagnostics, &Diagnostic{wn.FilePath, problem.line, column, rule.Severity,
+					fmt.Sprintf("%s: %s [%s]", id, problem.message, rule.Name)})
+			}
+		}
+		if changed {
+			wn.Sections = slices.DeleteFunc(wn.Sections, func(sct *Section) bool { return sct == nil || sct.removed() })
+		}
+	}
+	slices.SortStableFunc(diagnostics, func(a, b *Diagnostic) int { return a.Line - b.Line })
+	return diagnostics, changed
+}
+
+// removed returns true if a lint fix merged the section into another section.
+func (s *Section) removed() bool {
+	return s.Note == "" && s.URL == ""
+}
+
+func checkBrokenLinks(l *Linter, wn *WebNote, sct *Section) []*lintProblem {
+	problems := []*lintProblem{}
+	for i, line := range sct.Body {
+		for _, match := range webNoteLinkRegexp.FindAllStringSubmatch(line, -1) {
+			if strings.HasPrefix(match[1], "http://") || strings.HasPrefix(match[1], "https://") {
+				continue
+			}
+			notes, ok := l.Notes[filepath.Clean(match[1])]
+			if !ok {
+				problems = append(problems, bodyProblem(wn, sct, i, fmt.Sprintf("link to missing file %s", match[1])))
+			} else if !slices.Contains(notes, match[2]) {
+				problems = append(problems, bodyProblem(wn, sct, i, fmt.Sprintf("link to missing note %s#%s", match[1], match[2])))
+			}
+		}
+	}
+	return problems
+}
+
+func checkDateFormat(l *Linter, wn *WebNote, sct *Section) []*lintProblem {
+	date, ok := sct.FieldValue("date")
+	if !ok {
+		return nil
+	}
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return []*lintProblem{fieldProblem(wn, sct, "date", fmt.Sprintf("date is not YYYY-MM-DD: %s", date))}
+	}
+	return nil
+}
+
+func fixDateFormat(l *Linter, wn *WebNote, sct *Section) bool {
+	date, ok := sct.FieldValue("date")
+	if !ok {
+		return false
+	}
+	if _, err := time.Parse(time.DateOnly, date); err == nil {
+		return false
+	}
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, date)
+		if err == nil {
+			sct.SetFieldValue("date", t.Format(time.DateOnly))
+			return true
+		}
+	}
+	return false
+}
+
+// duplicateOf returns the first section in the WebNote that matches sct, if it is not sct.
+func duplicateOf(wn *WebNote, sct *Section) (*Section, bool) {
+	for _, other := range wn.Sections {
+		if other == sct {
+			return nil, false
+		}
+		if other != nil && !other.removed() && other.Matches(sct) {
+			return other, true
+		}
+	}
+	return nil, false
+}
+
+func checkDuplicateNote(l *Linter, wn *WebNote, sct *Section) []*lintProblem {
+	if sct.Note == "" {
+		return nil
+	}
+	if _, ok := duplicateOf(wn, sct); ok {
+		return []*lintProblem{sectionProblem(wn, sct, "note is already in the file, which breaks building the index")}
+	}
+	return nil
+}
+
+func checkDuplicateURL(l *Linter, wn *WebNote, sct *Section) []*lintProblem {
+	if sct.URL == "" {
+		return nil
+	}
+	if _, ok := duplicateOf(wn, sct); ok {
+		return []*lintProblem{sectionProblem(wn, sct, "url is already in the file")}
+	}
+	return nil
+}
+
+func fixDuplicateNote(l *Linter, wn *WebNote, sct *Section) bool {
+	return sct.Note != "" && fixDuplicate(wn, sct)
+}
+
+func fixDuplicateURL(l *Linter, wn *WebNote, sct *Section) bool {
+	return sct.URL != "" && fixDuplicate(wn, sct)
+}
+
+// fixDuplicate combines a section into the first section that matches it.
+// The combined section is emptied so Lint removes it.
+func fixDuplicate(wn *WebNote, sct *Section) bool {
+	first, ok := duplicateOf(wn, sct)
+	if !ok {
+		return false
+	}
+	first.Add(sct)
+	sct.Note, sct.URL = "", ""
+	return true
+}
+
+func checkEmptyBody(l *Linter, wn *WebNote, sct *Section) []*lintProblem {
+	if sct.Note == "" {
+		return nil
+	}
+	for _, line := range sct.Body {
+		if strings.TrimSpace(line) != "" {
+			return nil
+		}
+	}
+	return []*lintProblem{sectionProblem(wn, sct, "note has no body")}
+}
+
+func checkInvalidURL(l *Linter, wn *WebNote, sct *Section) []*lintProblem {
+	if sct.URL == "" {
+		return nil
+	}
+	url_, err := url.Parse(sct.URL)
+	if err != nil {
+		return []*lintProblem{sectionProblem(wn, sct, fmt.Sprintf("url does not parse: %s", err))}
+	}
+	if (url_.Scheme != "http" && url_.Scheme != "https") || url_.Host == "" {
+		return []*lintProblem{sectionProblem(wn, sct, "url is not an http or https url with a host")}
+	}
+	return nil
+}
+
+// staleStatusFields returns the status and error fields of a section that no longer apply.
+// Notes have nothing to fetch, a section should not have both, and a 200 status is not an error.
+func staleStatusFields(sct *Section) []string {
+	stale := []string{}
+	if sct.Note != "" {
+		for _, name := range []string{"error", "status"} {
+			if sct.HasField(name) {
+				stale = append(stale, name)
+			}
+		}
+		return stale
+	}
+	if sct.HasField("error") && sct.HasField("status") {
+		stale = append(stale, "status")
+	}
+	if status, ok := sct.FieldValue("status"); ok && strings.HasPrefix(status, "200") && !slices.Contains(stale, "status") {
+		stale = append(stale, "status")
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+func checkStaleStatus(l *Linter, wn *WebNote, sct *Section) []*lintProblem {
+	problems := []*lintProblem{}
+	for _, name := range staleStatusFields(sct) {
+		problems = append(problems, fieldProblem(wn, sct, name, fmt.Sprintf("%s field no longer applies", name)))
+	}
+	return problems
+}
+
+func fixStaleStatus(l *Linter, wn *WebNote, sct *Section) bool {
+	stale := staleStatusFields(sct)
+	sct.DeleteFields(stale...)
+	return len(stale) > 0
+}
+
+func checkUnknownField(l *Linter, wn *WebNote, sct *Section) []*lintProblem {
+	problems := []*lintProblem{}
+	for _, field := range sct.Fields {
+		if !slices.Contains(orderedFieldNames, field.Name) {
+			problems = append(problems, fieldProblem(wn, sct, field.Name, fmt.Sprintf("unknown field %s", field.Name)))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,180 @@
+package webnotes
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Ways of choosing the section duplicates are merged into.
+const (
+	// the section with the earliest date, sections without a date come last
+	MergeHomeOldest string = "oldest"
+	// the section with the most tags
+	MergeHomeTags string = "tags"
+	// the section in the file that comes first in Priority, files not in Priority come last
+	MergeHomePriority string = "priority"
+)
+
+// Struct for merging duplicate sections across webnote files.
+// Home is one of the MergeHome constants and Priority is a list of file paths.
+// Ties are won by the section that comes first in the files given to Merge.
+type Merger struct {
+	Home     string
+	Priority []string
+}
+
+// Struct for one set of duplicate sections that were merged.
+// Section is the section the others were merged into and Files are the files the others were removed from.
+type Merge struct {
+	ID      string
+	WebNote *WebNote
+	Section *Section
+	Files   []string
+}
+
+// NewMerger returns a Merger.
+// Returns (*Merger, nil) on success.
+// Returns (nil, error) if home is not one of the MergeHome constants.
+func NewMerger(home string, priority []string) (*Merger, error) {
+	if home == "" {
+		home = MergeHomeOldest
+	}
+	if !slices.Contains([]string{MergeHomeOldest, MergeHomePriority, MergeHomeTags}, home) {
+		return nil, errors.New(fmt.Sprintf("Invalid merge home: %s, must be oldest, priority or tags", home))
+	}
+	cleaned := []string{}
+	for _, fp := range priority {
+		cleaned = append(cleaned, filepath.Clean(fp))
+	}
+	return &Merger{home, cleaned}, nil
+}
+
+// Struct for a section and the WebNote it is in.
+type mergeCandidate struct {
+	wn  *WebNote
+	sct *Section
+}
+
+// better returns true if a should be the home instead of b.
+func (m *Merger) better(a, b *mergeCandidate) bool {
+	switch m.Home {
+	case MergeHomeTags:
+		aTags, _ := a.sct.FieldValues("tags")
+		bTags, _ := b.sct.FieldValues("tags")
+		return len(aTags) > len(bTags)
+	case MergeHomePriority:
+		return m.priority(a.wn) < m.priority(b.wn)
+	default:
+		aDate, aOk := mergeDate(a.sct)
+		bDate, bOk := mergeDate(b.sct)
+		return aOk && (!bOk || aDate.Before(bDate))
+	}
+}
+
+// priority returns where the WebNote's file is in Priority.
+func (m *Merger) priority(wn *WebNote) int {
+	i := slices.Index(m.Priority, filepath.Clean(wn.FilePath))
+	if i < 0 {
+		return len(m.Priority)
+	}
+	return i
+}
+
+// mergeDate returns the section's date.
+// Returns (date, true) if the section has a valid date.
+// Returns (time.Time{}, false) otherwise.
+func mergeDate(sct *Section) (time.Time, bool) {
+	value, ok := sct.FieldValue("date")
+	if !ok {
+		return time.Time{}, false
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// Merge merges each set of duplicate sections in the WebNotes into one of them, chosen by Home.
+// Fields and bodies are merged with Section.Add and the other sections are removed from their WebNotes.
+// Sections are duplicates if they match, see Section.Matches.
+// Returns ([]*Merge, map of moved note links, nil) on success.
+// The map is from links like "Old.wn#note" to the file the note was merged into, see RewriteNoteLinks.
+// Returns (nil, nil, error) if a section has no ID.
+func (m *Merger) Merge(wns []*WebNote) ([]*Merge, map[string]string, error) {
+	ids := []string{}
+	groups := map[string][]*mergeCandidate{}
+	for _, wn := range wns {
+		for _, sct := range wn.Sections {
+			id, err := sct.CanonicalID()
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, ok := groups[id]; !ok {
+				ids = append(ids, id)
+			}
+			groups[id] = append(groups[id], &mergeCandidate{wn, sct})
+		}
+	}
+	merges := []*Merge{}
+	moves := map[string]string{}
+	removed := map[*Section]bool{}
+	for _, id := range ids {
+		group := groups[id]
+		if len(group) < 2 {
+			continue
+		}
+		home := group[0]
+		for _, c := range group[1:] {
+			if m.better(c, home) {
+				home = c
+			}
+		}
+		homeID, _ := home.sct.ID()
+		merge := &Merge{homeID, home.wn, home.sct, []string{}}
+		for _, c := range group {
+			if c == home {
+				continue
+			}
+			home.sct.Add(c.sct)
+			removed[c.sct] = true
+			if !slices.Contains(merge.Files, c.wn.FilePath) {
+				merge.Files = append(merge.Files, c.wn.FilePath)
+			}
+			if c.sct.Note != "" && c.wn != home.wn {
+				moves[filepath.Clean(c.wn.FilePath)+"#"+c.sct.Note] = home.wn.FilePath
+			}
+		}
+		merges = append(merges, merge)
+	}
+	for _, wn := range wns {
+		wn.Sections = slices.DeleteFunc(wn.Sections, func(sct *Section) bool { return removed[sct] })
+	}
+	return merges, moves, nil
+}
+
+// RewriteNoteLinks changes links like [text](Old.wn#note) in the bodies of the WebNote's sections
+// to point at the files notes were moved to.
+// moves is from links like "Old.wn#note" to the file the note is now in.
+// Returns the number of links changed.
+func RewriteNoteLinks(wn *WebNote, moves map[string]string) int {
+	count := 0
+	for _, sct := range wn.Sections {
+		for i, line := range sct.Body {
+			sct.Body[i] = webNoteLinkRegexp.ReplaceAllStringFunc(line, func(link string) string {
+				match := webNoteLinkRegexp.FindStringSubmatch(link)
+				to, ok := moves[filepath.Clean(match[1])+"#"+match[2]]
+				if !ok {
+					return link
+				}
+				count++
+				return strings.Replace(link, match[1]+"#", to+"#", 1)
+			})
+		}
+	}
+	return count
+}
@@ -0,0 +1,272 @@
+package webnotes
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+var pdfStreamRegexp = regexp.MustCompile(`>>\s*stream\r?\n`)
+var pdfTitleRegexp = regexp.MustCompile(`/Title\s*([(<])`)
+
+// PDFContent extracts the title and text from a PDF document.
+// This is a best effort extraction that does not use a full PDF parser.
+// It understands uncompressed and FlateDecode streams and the common text operators.
+// Text in fonts with custom encodings may not be extracted.
+// Returns the title (or "" if none is found) and the lines of text.
+func PDFContent(data []byte) (string, []string) {
+	streams := pdfStreams(data)
+	title := pdfTitle(data)
+	for i := 0; title == "" && i < len(streams); i++ {
+		title = pdfTitle(streams[i])
+	}
+	lines := []string{}
+	for _, stream := range streams {
+		lines = append(lines, pdfText(stream)...)
+	}
+	return title, lines
+}
+
+// pdfStreams returns the decoded streams of a PDF document.
+// Streams with filters other than FlateDecode are skipped.
+func pdfStreams(data []byte) [][]byte {
+	streams := [][]byte{}
+	for _, loc := range pdfStreamRegexp.FindAllIndex(data, -1) {
+		dict := pdfDictionaryBefore(data, loc[0]+2)
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		if strings.Contains(dict, "/Subtype /Image") || strings.Contains(dict, "/Subtype/Image") {
+			continue
+		}
+		raw := data[start : start+end]
+		if strings.Contains(dict, "/Filter") {
+			if !strings.Contains(dict, "/FlateDecode") || pdfHasOtherFilter(dict) {
+				continue
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				continue
+			}
+			decoded, _ := io.ReadAll(reader)
+			reader.Close()
+			raw = decoded
+		}
+		streams = append(streams, raw)
+	}
+	return streams
+}
+
+// pdfDictionaryBefore returns the dictionary that ends just before data[end].
+// Nested dictionaries are included in the returned string.
+func pdfDictionaryBefore(data []byte, end int) string {
+	depth := 0
+	for i := end - 2; i >= 0; i-- {
+		if data[i] == '>' && data[i+1] == '>' {
+			depth++
+			i--
+		} else if data[i] == '<' && data[i+1] == '<' {
+			depth--
+			if depth == 0 {
+				return string(data[i:end])
+			}
+		}
+	}
+	return ""
+}
+
+// pdfHasOtherFilter returns true if a stream dictionary has a filter besides FlateDecode.
+func pdfHasOtherFilter(dict string) bool {
+	for _, filter := range []string{"/DCTDecode", "/JPXDecode", "/CCITTFaxDecode", "/JBIG2Decode", "/LZWDecode", "/RunLengthDecode", "/ASCII85Decode", "/ASCIIHexDecode"} {
+		if strings.Contains(dict, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// pdfTitle returns the /Title entry found in data or "" if there is none.
+func pdfTitle(data []byte) string {
+	loc := pdfTitleRegexp.FindSubmatchIndex(data)
+	if loc == nil {
+		return ""
+	}
+	var raw []byte
+	if data[loc[2]] == '(' {
+		raw, _ = pdfLiteralString(data, loc[2])
+	} else {
+		raw, _ = pdfHexString(data, loc[2])
+	}
+	return RemoveExtraWhitespace(pdfDecodeTextString(raw))
+}
+
+// pdfText returns the lines of text shown by the text operators in a content stream.
+func pdfText(stream []byte) []string {
+	lines := []string{}
+	var line strings.Builder
+	operands := [][]byte{}
+	endLine := func() {
+		text := RemoveExtraWhitespace(line.String())
+		if text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+	for i := 0; i < len(stream); {
+		c := stream[i]
+		switch {
+		case c == '(':
+			s, next := pdfLiteralString(stream, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(stream) && stream[i+1] != '<':
+			s, next := pdfHexString(stream, i)
+			operands = append(operands, s)
+			i = next
+		case c == '%':
+			for i < len(stream) && stream[i] != '\n' && stream[i] != '\r' {
+				i++
+			}
+		case c == '[' || c == ']':
+			i++
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			start := i
+			for i < len(stream) && (stream[i] == '-' || stream[i] == '.' || (stream[i] >= '0' && stream[i] <= '9')) {
+				i++
+			}
+			// large negative kerning in a TJ array usually means a space
+			if n, err := strconv.ParseFloat(string(stream[start:i]), 64); err == nil && n < -200 && len(operands) > 0 {
+				operands = append(operands, []byte(" "))
+			}
+		case unicode.IsLetter(rune(c)) || c == '\'' || c == '"' || c == '*':
+			start := i
+			for i < len(stream) && (unicode.IsLetter(rune(stream[i])) || stream[i] == '*' || stream[i] == '\'' || stream[i] == '"') {
+				i++
+			}
+			switch string(stream[start:i]) {
+			case "Tj", "TJ":
+				for _, s := range operands {
+					line.WriteString(pdfDecodeTextString(s))
+				}
+			case "'", "\"":
+				endLine()
+				for _, s := range operands {
+					line.WriteString(pdfDecodeTextString(s))
+				}
+			case "T*", "Td", "TD", "ET":
+				endLine()
+			}
+			operands = operands[:0]
+		default:
+			i++
+		}
+	}
+	endLine()
+	return lines
+}
+
+// pdfLiteralString reads a (literal) string that starts at data[start].
+// Returns the string and the index after the closing parenthesis.
+func pdfLiteralString(data []byte, start int) ([]byte, int) {
+	var buf bytes.Buffer
+	depth := 0
+	i := start
+	for ; i < len(data); i++ {
+		c := data[i]
+		if c == '\\' && i+1 < len(data) {
+			i++
+			switch e := data[i]; e {
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case 'b':
+				buf.WriteByte('\b')
+			case 'f':
+				buf.WriteByte('\f')
+			case '\r', '\n':
+				// line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					j := i
+					for j < len(data) && j < i+3 && data[j] >= '0' && data[j] <= '7' {
+						j++
+					}
+					n, _ := strconv.ParseUint(string(data[i:j]), 8, 8)
+					buf.WriteByte(byte(n))
+					i = j - 1
+				} else {
+					buf.WriteByte(e)
+				}
+			}
+			continue
+		}
+		if c == '(' {
+			depth++
+			if depth == 1 {
+				continue
+			}
+		} else if c == ')' {
+			depth--
+			if depth == 0 {
+				return buf.Bytes(), i + 1
+			}
+		}
+		buf.WriteByte(c)
+	}
+	return buf.Bytes(), i
+}
+
+// pdfHexString reads a <hex> string that starts at data[start].
+// Returns the string and the index after the closing angle bracket.
+func pdfHexString(data []byte, start int) ([]byte, int) {
+	end := bytes.IndexByte(data[start:], '>')
+	if end < 0 {
+		return nil, len(data)
+	}
+	hex := []byte{}
+	for _, c := range data[start+1 : start+end] {
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			hex = append(hex, c)
+		}
+	}
+	if len(hex)%2 == 1 {
+		hex = append(hex, '0')
+	}
+	s := make([]byte, len(hex)/2)
+	for i := range s {
+		n, _ := strconv.ParseUint(string(hex[2*i:2*i+2]), 16, 8)
+		s[i] = byte(n)
+	}
+	return s, start + end + 1
+}
+
+// pdfDecodeTextString decodes a PDF text string.
+// Strings starting with a UTF-16BE byte order mark are decoded as UTF-16.
+// Other strings are treated as Latin-1 with unprintable characters dropped.
+func pdfDecodeTextString(s []byte) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		units := []uint16{}
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	var b strings.Builder
+	for _, c := range s {
+		r := rune(c)
+		if unicode.IsPrint(r) || unicode.IsSpace(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,248 @@
+package webnotes
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrDisallowed is returned by Fetcher.Get and Fetcher.Head for urls robots.txt does not allow.
+var ErrDisallowed = errors.New("Url is disallowed by robots.txt")
+
+// Struct for the robots.txt rules that apply to the Fetcher's user agent.
+type RobotsRules struct {
+	Allow      []string
+	Disallow   []string
+	CrawlDelay time.Duration
+}
+
+// most of a robots.txt file that is read, the least RFC 9309 asks crawlers to parse
+const maxRobotsTxtSize = 500 << 10
+
+// robotsAllowAll is used for hosts that have no robots.txt.
+var robotsAllowAll = &RobotsRules{}
+
+// robotsDisallowAll is used for hosts whose robots.txt is unavailable because of a server error.
+var robotsDisallowAll = &RobotsRules{Disallow: []string{"/"}}
+
+// ParseRobotsTxt parses a robots.txt file and returns the rules for the user agent.
+// The rules of the group with the longest name matching the user agent's product token are used,
+// see robotsAgentMatches.
+// If no group matches it, or the user agent has no product token, the rules of the * group are used.
+func ParseRobotsTxt(data string, userAgent string) *RobotsRules {
+	token := ""
+	if fields := strings.FieldsFunc(userAgent, func(r rune) bool { return r == '/' || unicode.IsSpace(r) }); len(fields) > 0 {
+		token = strings.ToLower(fields[0])
+	}
+	groups := map[string]*RobotsRules{}
+	agents := []string{}
+	inRules := false
+	for _, line := range strings.Split(data, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+		if name == "user-agent" {
+			if inRules {
+				agents = []string{}
+				inRules = false
+			}
+			agent := strings.ToLower(value)
+			agents = append(agents, agent)
+			if _, ok := groups[agent]; !ok {
+				groups[agent] = &RobotsRules{}
+			}
+			continue
+		}
+		inRules = true
+		for _, agent := range agents {
+			rules := groups[agent]
+			switch name {
+			case "allow":
+				if value != "" {
+					rules.Allow = append(rules.Allow, value)
+				}
+			case "disallow":
+				if value != "" {
+					rules.Disallow = append(rules.Disallow, value)
+				}
+			case "crawl-delay":
+				seconds, err := strconv.ParseFloat(value, 64)
+				if err == nil {
+					rules.CrawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+	match := ""
+	for agent := range groups {
+		if agent != "*" && robotsAgentMatches(agent, token) && len(agent) > len(match) {
+			match = agent
+		}
+	}
+	if match != "" {
+		return groups[match]
+	}
+	if rules, ok := groups["*"]; ok {
+		return rules
+	}
+	return robotsAllowAll
+}
+
+// robotsAgentMatches returns true if a group's user agent applies to a lower cased product token.
+// As in RFC 9309 the names are compared without regard to case, and the group applies if it is the
+// product token or the start of it up to a - or _, so googlebot applies to googlebot-news but a applies to neither.
+func robotsAgentMatches(agent, token string) bool {
+	if token == "" {
+		return false
+	}
+	if agent == token {
+		return true
+	}
+	rest, ok := strings.CutPrefix(token, agent)
+	return ok && (rest[0] == '-' || rest[0] == '_')
+}
+
+// Allowed returns true if the rules allow the path of a url.
+// The longest matching rule wins and Allow wins ties.
+func (r *RobotsRules) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	allow, disallow := -1, -1
+	for _, pattern := range r.Allow {
+		if len(pattern) > allow && robotsPatternMatches(pattern, path) {
+			allow = len(pattern)
+		}
+	}
+	for _, pattern := range r.Disallow {
+		if len(pattern) > disallow && robotsPatternMatches(pattern, path) {
+			disallow = len(pattern)
+		}
+	}
+	return allow >= disallow
+}
+
+// robotsPatternMatches matches a robots.txt path pattern that can use * and $.
+func robotsPatternMatches(pattern, path string) bool {
+	if !strings.ContainsAny(pattern, "*$") {
+		return strings.HasPrefix(path, pattern)
+	}
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	if strings.HasSuffix(expr, `\$`) {
+		expr = expr[:len(expr)-2] + "$"
+	}
+	re, err := regexp.Compile("^" + expr)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(path)
+}
+
+// isOwnHost returns true if the host is one of the Fetcher's own hosts.
+// Own hosts are not checked against robots.txt and are not rate limited.
+func (f *Fetcher) isOwnHost(host string) bool {
+	return slices.Contains(f.OwnHosts, host)
+}
+
+// robotsRules returns the robots.txt rules for the url's host.
+// The robots.txt file for each host is fetched once and the rules, or the error fetching it, are kept in memory.
+// Returns (*RobotsRules, nil) on success.
+// Returns (nil, error) if robots.txt cannot be fetched.
+func (f *Fetcher) robotsRules(u *url.URL) (*RobotsRules, error) {
+	key := u.Scheme + "://" + u.Host
+	if rules, ok := f.robots[key]; ok {
+		return rules, nil
+	}
+	if err, ok := f.robotsErrors[key]; ok {
+		return nil, err
+	}
+	rules, err := f.fetchRobotsTxt(key + "/robots.txt")
+	if err != nil {
+		f.robotsErrors[key] = err
+		return nil, err
+	}
+	f.robots[key] = rules
+	return rules, nil
+}
+
+// fetchRobotsTxt fetches and parses a robots.txt file.
+// It is fetched with a plain request, robots.txt files are not cached or written to WARC.
+// Returns (*RobotsRules, nil) on success.
+// Returns (nil, error) if robots.txt cannot be fetched.
+func (f *Fetcher) fetchRobotsTxt(rawURL string) (*RobotsRules, error) {
+	client, err := f.Client()
+	if err != nil {
+		return nil, err
+	}
+	req, err := f.newRequest("GET", rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.politeness(req.URL, false); err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return robotsDisallowAll, nil
+	} else if resp.StatusCode != 200 {
+		return robotsAllowAll, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsTxtSize))
+	if err != nil {
+		return nil, err
+	}
+	return ParseRobotsTxt(string(body), f.UserAgent), nil
+}
+
+// politeness checks robots.txt and waits so that requests to a host are spaced out.
+// Requests to a host are at least MinInterval or the host's Crawl-delay apart, whichever is longer.
+// Returns nil if the request can be made.
+// Returns ErrDisallowed if robots.txt does not allow the url.
+// Returns error if robots.txt cannot be fetched.
+func (f *Fetcher) politeness(u *url.URL, checkRobots bool) error {
+	if f.isOwnHost(u.Hostname()) {
+		return nil
+	}
+	if f.robots == nil {
+		f.robots = make(map[string]*RobotsRules)
+		f.robotsErrors = make(map[string]error)
+		f.lastRequest = make(map[string]time.Time)
+	}
+	interval := f.MinInterval
+	if f.RobotsTxt && checkRobots {
+		rules, err := f.robotsRules(u)
+		if err != nil {
+			return err
+		}
+		if !rules.Allowed(u.RequestURI()) {
+			return ErrDisallowed
+		}
+		if rules.CrawlDelay > interval {
+			interval = rules.CrawlDelay
+		}
+	}
+	if last, ok := f.lastRequest[u.Host]; ok {
+		if wait := interval - time.Since(last); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	f.lastRequest[u.Host] = time.Now()
+	return nil
+}
@@ -0,0 +1,190 @@
+package webnotes
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// number of hashes in a MinHash signature
+const minHashSize = 64
+
+// sections with fewer words than this are not compared, short texts match too easily
+const minSimilarWords = 5
+
+// words per shingle
+const shingleSize = 3
+
+// Struct for a section and the WebNote it is in.
+type SimilarSection struct {
+	WebNote *WebNote
+	Section *Section
+}
+
+// Struct for a cluster of sections whose contents are similar.
+// Similarity is the lowest estimated similarity of the pairs of sections that joined the cluster.
+type SimilarCluster struct {
+	Sections   []*SimilarSection
+	Similarity float64
+}
+
+// Struct for finding sections whose titles and bodies are nearly the same.
+// Each section's words are turned into shingles and a MinHash signature,
+// sections are paired up with locality sensitive hashing of the signatures,
+// and pairs at least as similar as Threshold are clustered.
+// Similarity is the estimated Jaccard similarity of the shingles, from 0 to 1.
+type SimilarityFinder struct {
+	Threshold  float64
+	sections   []*SimilarSection
+	signatures [][]uint64
+}
+
+// NewSimilarityFinder returns a SimilarityFinder for the threshold provided.
+func NewSimilarityFinder(threshold float64) *SimilarityFinder {
+	return &SimilarityFinder{Threshold: threshold}
+}
+
+// Add adds a section to be compared.
+// Sections with too few words are skipped.
+func (f *SimilarityFinder) Add(wn *WebNote, sct *Section) {
+	text := strings.Join(sct.Body, "\n")
+	if title, ok := sct.FieldValue("title"); ok {
+		text = title + "\n" + text
+	}
+	shingles := textShingles(text)
+	if shingles == nil {
+		return
+	}
+	f.sections = append(f.sections, &SimilarSection{wn, sct})
+	f.signatures = append(f.signatures, minHash(shingles))
+}
+
+// textShingles returns the shingles of the words of the text.
+// Returns nil if the text has too few words.
+func textShingles(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) < minSimilarWords {
+		return nil
+	}
+	shingles := []string{}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		shingles = append(shingles, strings.Join(words[i:i+shingleSize], " "))
+	}
+	return shingles
+}
+
+// mix is the finalizer of splitmix64, which spreads the bits of x.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// minHash returns the MinHash signature of the shingles.
+func minHash(shingles []string) []uint64 {
+	signature := make([]uint64, minHashSize)
+	for i := range signature {
+		signature[i] = ^uint64(0)
+	}
+	for _, shingle := range shingles {
+		h := fnv.New64a()
+		h.Write([]byte(shingle))
+		base := h.Sum64()
+		for i := range signature {
+			if v := mix(base ^ mix(uint64(i+1))); v < signature[i] {
+				signature[i] = v
+			}
+		}
+	}
+	return signature
+}
+
+// similarity returns the fraction of the two signatures' hashes that are the same.
+func similarity(a, b []uint64) float64 {
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
+
+// Clusters returns the clusters of similar sections in the order their first sections were added.
+// Sections with the same note or URL are not paired, they are duplicates rather than near duplicates.
+func (f *SimilarityFinder) Clusters() []*SimilarCluster {
+	// fewer rows per band finds pairs that are less similar
+	rows := 4
+	if f.Threshold < 0.5 {
+		rows = 2
+	}
+	parent := make([]int, len(f.sections))
+	lowest := make([]float64, len(f.sections))
+	for i := range parent {
+		parent[i] = i
+		lowest[i] = 1
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	compared := map[[2]int]bool{}
+	for band := 0; band < minHashSize/rows; band++ {
+		buckets := map[string][]int{}
+		for i, signature := range f.signatures {
+			key := strings.Builder{}
+			for _, v := range signature[band*rows : (band+1)*rows] {
+				key.WriteString(strconv.FormatUint(v, 36) + ",")
+			}
+			buckets[key.String()] = append(buckets[key.String()], i)
+		}
+		for _, bucket := range buckets {
+			for x := 0; x < len(bucket); x++ {
+				for y := x + 1; y < len(bucket); y++ {
+					i, j := bucket[x], bucket[y]
+					if compared[[2]int{i, j}] {
+						continue
+					}
+					compared[[2]int{i, j}] = true
+					if f.sections[i].Section.Matches(f.sections[j].Section) {
+						continue
+					}
+					s := similarity(f.signatures[i], f.signatures[j])
+					if s < f.Threshold {
+						continue
+					}
+					ri, rj := find(i), find(j)
+					low := min(s, lowest[ri], lowest[rj])
+					if ri < rj {
+						parent[rj] = ri
+						lowest[ri] = low
+					} else {
+						parent[ri] = rj
+						lowest[rj] = low
+					}
+				}
+			}
+		}
+	}
+	members := make([][]*SimilarSection, len(f.sections))
+	for i, s := range f.sections {
+		root := find(i)
+		members[root] = append(members[root], s)
+	}
+	clusters := []*SimilarCluster{}
+	for root, sections := range members {
+		if len(sections) > 1 {
+			clusters = append(clusters, &SimilarCluster{sections, lowest[root]})
+		}
+	}
+	return clusters
+}
@@ -0,0 +1,137 @@
+package webnotes
+
+import (
+	"sort"
+	"time"
+)
+
+// Struct for the number of sections with a tag, host, author, file or year.
+type Count struct {
+	Name  string
+	Count int
+}
+
+// Struct for how often two tags are on the same sections.
+// Overlap is Count divided by the count of the less used tag.
+// An overlap of 1 means every section with that tag also has the other, so one of them may be redundant.
+type TagPair struct {
+	Tags    [2]string
+	Count   int
+	Overlap float64
+}
+
+// Struct for statistics about a set of sections.
+// Counts are sorted by count, highest first, except Years, which are in order.
+// TagPairs are sorted by overlap and then count, highest first.
+type Stats struct {
+	Sections int
+	Untagged int
+	Undated  int
+	Tags     []*Count
+	Hosts    []*Count
+	Authors  []*Count
+	Files    []*Count
+	Years    []*Count
+	TagPairs []*TagPair
+}
+
+// Struct for adding up statistics one section at a time.
+type StatsCounter struct {
+	sections, untagged, undated        int
+	tags, hosts, authors, files, years map[string]int
+	pairs                              map[[2]string]int
+}
+
+// NewStatsCounter returns an empty StatsCounter.
+func NewStatsCounter() *StatsCounter {
+	return &StatsCounter{
+		tags:    make(map[string]int),
+		hosts:   make(map[string]int),
+		authors: make(map[string]int),
+		files:   make(map[string]int),
+		years:   make(map[string]int),
+		pairs:   make(map[[2]string]int),
+	}
+}
+
+// Add adds a section of a WebNote to the statistics.
+func (c *StatsCounter) Add(wn *WebNote, sct *Section) {
+	c.sections++
+	c.files[wn.FilePath]++
+	if host, err := sct.Host(); err == nil {
+		c.hosts[host]++
+	}
+	if author, ok := sct.FieldValue("author"); ok {
+		c.authors[author]++
+	}
+	if value, ok := sct.FieldValue("date"); ok {
+		if date, err := time.Parse(time.DateOnly, value); err == nil {
+			c.years[date.Format("2006")]++
+		} else {
+			c.undated++
+		}
+	} else {
+		c.undated++
+	}
+	tags, _ := sct.FieldValues("tags")
+	tags = ResolveTags(tags)
+	if len(tags) == 0 {
+		c.untagged++
+	}
+	sort.Strings(tags)
+	for i, tag := range tags {
+		c.tags[tag]++
+		for _, other := range tags[i+1:] {
+			c.pairs[[2]string{tag, other}]++
+		}
+	}
+}
+
+// sortedCounts returns the counts, highest first and then by name.
+func sortedCounts(counts map[string]int) []*Count {
+	sorted := []*Count{}
+	for name, count := range counts {
+		sorted = append(sorted, &Count{name, count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// Stats returns the statistics of the sections added.
+func (c *StatsCounter) Stats() *Stats {
+	years := sortedCounts(c.years)
+	sort.Slice(years, func(i, j int) bool { return years[i].Name < years[j].Name })
+	pairs := []*TagPair{}
+	for tags, count := range c.pairs {
+		overlap := float64(count) / float64(min(c.tags[tags[0]], c.tags[tags[1]]))
+		pairs = append(pairs, &TagPair{tags, count, overlap})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Overlap != pairs[j].Overlap {
+			return pairs[i].Overlap > pairs[j].Overlap
+		}
+		if pairs[i].Count != pairs[j].Count {
+			return pairs[i].Count > pairs[j].Count
+		}
+		if pairs[i].Tags[0] != pairs[j].Tags[0] {
+			return pairs[i].Tags[0] < pairs[j].Tags[0]
+		}
+		return pairs[i].Tags[1] < pairs[j].Tags[1]
+	})
+	return &Stats{
+		Sections: c.sections,
+		Untagged: c.untagged,
+		Undated:  c.undated,
+		Tags:     sortedCounts(c.tags),
+		Hosts:    sortedCounts(c.hosts),
+		Authors:  sortedCounts(c.authors),
+		Files:    sortedCounts(c.files),
+		Years:    years,
+		TagPairs: pairs,
+	}
+}
@@ -0,0 +1,296 @@
+package webnotes
+
+import (
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Kinds of evidence a tag suggestion can come from.
+const (
+	// tags of other sections from the same host
+	SuggestionHost string = "host"
+	// tags of sections with the section's most distinctive words
+	SuggestionKeywords string = "keywords"
+	// tags of sections with the same url or links
+	SuggestionLinks string = "links"
+)
+
+// DefaultSuggestionConfidence is the least confidence of the suggestions that are used if none is given.
+const DefaultSuggestionConfidence float64 = 0.6
+
+// most keywords of a section used to suggest tags
+const maxKeywords = 10
+
+// shortest word that can be a keyword
+const minKeywordLength = 3
+
+// score of a tag named by one of a section's keywords,
+// below DefaultSuggestionConfidence so a keyword alone is not enough to suggest a tag
+const keywordTagScore = 0.4
+
+// common words that say nothing about what a section is about
+var stopWords = map[string]bool{
+	"about": true, "after": true, "all": true, "also": true, "and": true, "any": true, "are": true, "back": true,
+	"because": true, "been": true, "but": true, "can": true, "com": true, "could": true, "did": true, "does": true,
+	"even": true, "first": true, "for": true, "from": true, "get": true, "had": true, "has": true, "have": true,
+	"her": true, "his": true, "how": true, "http": true, "https": true, "into": true, "its": true, "just": true,
+	"like": true, "more": true, "most": true, "new": true, "not": true, "now": true, "one": true, "only": true,
+	"other": true, "our": true, "out": true, "over": true, "read": true, "some": true, "than": true, "that": true,
+	"the": true, "their": true, "them": true, "then": true, "there": true, "these": true, "they": true,
+	"this": true, "two": true, "use": true, "using": true, "very": true, "was": true, "way": true, "were": true,
+	"what": true, "when": true, "which": true, "who": true, "why": true, "will": true, "with": true,
+	"would": true, "www": true, "you": true, "your": true,
+}
+
+var suggestURLRegexp = regexp.MustCompile(`https?://[^\s<>()\[\]"']+`)
+
+// Struct for a tag suggested for a section.
+// Confidence is from 0 to 1, Sources are the kinds of evidence for the tag, like SuggestionHost.
+type TagSuggestion struct {
+	Tag        string
+	Confidence float64
+	Sources    []string
+}
+
+// Struct for a tagged section in the corpus of a TagSuggester.
+type suggestSection struct {
+	filePath string
+	id       string
+	section  *Section
+	tags     []string
+}
+
+// Struct for suggesting tags for a section from how the sections in a corpus are tagged.
+// A tag is suggested by the tags of sections from the same host, by the tags of sections that share
+// the section's keywords, the words of its title and body with the highest TF-IDF in the corpus,
+// and by the tags of sections with the same url or links.
+// Each kind of evidence gives a score from 0 to 1 and the confidence is the chance any of them is right,
+// 1 - (1 - host) * (1 - keywords) * (1 - links).
+type TagSuggester struct {
+	sections []*suggestSection
+	// number of sections added and the number each word is in, for TF-IDF
+	documents         int
+	documentFrequency map[string]int
+	// indexes of the tagged sections with each host, word and link
+	hosts map[string][]int
+	words map[string][]int
+	links map[string][]int
+	// tags of the tagged sections
+	known map[string]bool
+}
+
+// NewTagSuggester returns a TagSuggester with an empty corpus.
+func NewTagSuggester() *TagSuggester {
+	return &TagSuggester{
+		documentFrequency: make(map[string]int),
+		hosts:             make(map[string][]int),
+		words:             make(map[string][]int),
+		links:             make(map[string][]int),
+		known:             make(map[string]bool),
+	}
+}
+
+// Add adds a section of a WebNote to the corpus.
+// Every section counts toward how common words are, but only the valid tags of tagged sections are suggested.
+func (s *TagSuggester) Add(wn *WebNote, sct *Section) {
+	words := unique(sectionWords(sct))
+	s.documents++
+	for _, word := range words {
+		s.documentFrequency[word]++
+	}
+	tags := []string{}
+	values, _ := sct.FieldValues("tags")
+	for _, tag := range ResolveTags(values) {
+		if ValidateTag(tag) == nil {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return
+	}
+	id, _ := sct.CanonicalID()
+	i := len(s.sections)
+	s.sections = append(s.sections, &suggestSection{wn.FilePath, id, sct, tags})
+	for _, tag := range tags {
+		s.known[tag] = true
+	}
+	if host, err := sct.Host(); err == nil {
+		s.hosts[host] = append(s.hosts[host], i)
+	}
+	for _, word := range words {
+		s.words[word] = append(s.words[word], i)
+	}
+	for _, link := range sectionLinks(sct) {
+		s.links[link] = append(s.links[link], i)
+	}
+}
+
+// sectionWords returns the lower cased words of a section's title, description and body, without urls and stop words.
+func sectionWords(sct *Section) []string {
+	text := []string{}
+	for _, name := range []string{"title", "description"} {
+		if value, ok := sct.FieldValue(name); ok {
+			text = append(text, value)
+		}
+	}
+	text = append(text, sct.Body...)
+	words := []string{}
+	for _, word := range strings.FieldsFunc(suggestURLRegexp.ReplaceAllString(strings.ToLower(strings.Join(text, "\n")), " "), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) < minKeywordLength || stopWords[word] || strings.IndexFunc(word, unicode.IsLetter) < 0 {
+			continue
+		}
+		words = append(words, word)
+	}
+	return words
+}
+
+// unique returns the values without repeats, in the order they first appear.
+func unique(values []string) []string {
+	seen := make(map[string]bool)
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// sectionLinks returns the canonical forms of a section's url and the urls in its body.
+func sectionLinks(sct *Section) []string {
+	links := []string{}
+	if sct.URL != "" {
+		links = append(links, CanonicalURL(sct.URL))
+	}
+	for _, line := range sct.Body {
+		for _, link := range suggestURLRegexp.FindAllString(line, -1) {
+			links = append(links, CanonicalURL(strings.TrimRight(link, ".,;:!?")))
+		}
+	}
+	return unique(links)
+}
+
+// keywords returns up to maxKeywords of the words with the highest TF-IDF, highest first.
+func (s *TagSuggester) keywords(words []string) []string {
+	counts := make(map[string]int)
+	for _, word := range words {
+		counts[word]++
+	}
+	scores := make(map[string]float64)
+	keywords := []string{}
+	for word, count := range counts {
+		idf := math.Log(float64(s.documents+1)/float64(s.documentFrequency[word]+1)) + 1
+		scores[word] = float64(count) * idf
+		keywords = append(keywords, word)
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		if scores[keywords[i]] != scores[keywords[j]] {
+			return scores[keywords[i]] > scores[keywords[j]]
+		}
+		return keywords[i] < keywords[j]
+	})
+	if len(keywords) > maxKeywords {
+		keywords = keywords[:maxKeywords]
+	}
+	return keywords
+}
+
+// Suggest returns the tags suggested for a section of a WebNote, most confident first.
+// The section itself is left out of the corpus, and tags it has, or has below them, are not suggested.
+func (s *TagSuggester) Suggest(wn *WebNote, sct *Section) []*TagSuggestion {
+	id, _ := sct.CanonicalID()
+	values, _ := sct.FieldValues("tags")
+	has := ResolveTags(values)
+	scores := make(map[string]map[string]float64)
+	score := func(source, tag string, value float64) {
+		if scores[tag] == nil {
+			scores[tag] = make(map[string]float64)
+		}
+		scores[tag][source] = max(scores[tag][source], value)
+	}
+	// shares returns the share of the sections that have each tag,
+	// one more section is counted so a tag on a single section is less certain than a tag on many
+	shares := func(indexes []int) map[string]float64 {
+		counts := make(map[string]int)
+		n := 0
+		for _, i := range indexes {
+			ss := s.sections[i]
+			if ss.section == sct || (ss.filePath == wn.FilePath && ss.id == id) {
+				continue
+			}
+			n++
+			for _, tag := range ss.tags {
+				counts[tag]++
+			}
+		}
+		shares := make(map[string]float64)
+		for tag, count := range counts {
+			shares[tag] = float64(count) / float64(n+1)
+		}
+		return shares
+	}
+	if host, err := sct.Host(); err == nil {
+		for tag, share := range shares(s.hosts[host]) {
+			score(SuggestionHost, tag, share)
+		}
+	}
+	for _, keyword := range s.keywords(sectionWords(sct)) {
+		if tag := ResolveTag(keyword); s.known[tag] {
+			score(SuggestionKeywords, tag, keywordTagScore)
+		}
+		for tag, share := range shares(s.words[keyword]) {
+			score(SuggestionKeywords, tag, share)
+		}
+	}
+	linked := []int{}
+	for _, link := range sectionLinks(sct) {
+		for _, i := range s.links[link] {
+			if !slices.Contains(linked, i) {
+				linked = append(linked, i)
+			}
+		}
+	}
+	for tag, share := range shares(linked) {
+		score(SuggestionLinks, tag, share)
+	}
+	suggestions := []*TagSuggestion{}
+	for tag, sources := range scores {
+		if hasTagUnder(has, tag) {
+			continue
+		}
+		unlikely := 1.0
+		ts := &TagSuggestion{Tag: tag}
+		for _, source := range []string{SuggestionHost, SuggestionKeywords, SuggestionLinks} {
+			if value, ok := sources[source]; ok {
+				unlikely *= 1 - value
+				ts.Sources = append(ts.Sources, source)
+			}
+		}
+		ts.Confidence = 1 - unlikely
+		suggestions = append(suggestions, ts)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Confidence != suggestions[j].Confidence {
+			return suggestions[i].Confidence > suggestions[j].Confidence
+		}
+		return suggestions[i].Tag < suggestions[j].Tag
+	})
+	return suggestions
+}
+
+// hasTagUnder returns true if one of the tags is the tag or one of its descendants.
+func hasTagUnder(tags []string, tag string) bool {
+	for _, t := range tags {
+		if TagIsUnder(t, tag) {
+			return true
+		}
+	}
+	return false
+}
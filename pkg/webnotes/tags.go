@@ -0,0 +1,128 @@
+package webnotes
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TagSeparator separates the levels of a hierarchical tag, like lang/go/generics.
+const TagSeparator string = "/"
+
+// MaxTagLength is the most characters a tag can have.
+const MaxTagLength int = 64
+
+// characters tags can have besides lower case letters, digits and TagSeparator
+const tagPunctuation string = "-_.+#"
+
+// ValidateTag checks that a tag is valid.
+// A valid tag:
+//   - has only lower case letters, digits, the characters - _ . + # and TagSeparator
+//   - has no empty levels, so it does not start or end with TagSeparator or have two in a row
+//   - has at most MaxTagLength characters
+//
+// Returns nil if the tag is valid.
+// Returns error describing the problem if it is not.
+func ValidateTag(tag string) error {
+	invalid := func(reason string) error {
+		return errors.New(fmt.Sprintf("Invalid tag %q: %s", tag, reason))
+	}
+	if tag == "" {
+		return invalid("tags cannot be empty")
+	}
+	if utf8.RuneCountInString(tag) > MaxTagLength {
+		return invalid(fmt.Sprintf("tags can have at most %d characters", MaxTagLength))
+	}
+	for _, level := range strings.Split(tag, TagSeparator) {
+		if level == "" {
+			return invalid("tag levels cannot be empty")
+		}
+	}
+	for _, r := range tag {
+		switch {
+		case unicode.IsSpace(r):
+			return invalid("tags cannot contain whitespace, use - instead")
+		case unicode.IsUpper(r):
+			return invalid("tags must be lower case")
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(tagPunctuation+TagSeparator, r):
+			return invalid(fmt.Sprintf("tags cannot contain %q", r))
+		}
+	}
+	return nil
+}
+
+// NormalizeTag returns a tag as it is typed, with surrounding whitespace removed and lower cased.
+// Returns (tag, nil) if the result is valid, see ValidateTag.
+// Returns ("", error) if it is not.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if err := ValidateTag(tag); err != nil {
+		return "", err
+	}
+	return tag, nil
+}
+
+// CleanTag returns a valid tag made from an invalid one, for migrating existing tags.
+// The tag is lower cased, whitespace becomes -, other characters that are not allowed are removed,
+// empty levels are removed and the tag is cut to MaxTagLength characters.
+// Returns "" if nothing is left.
+func CleanTag(tag string) string {
+	tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+	tag = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(tagPunctuation+TagSeparator, r) {
+			return r
+		}
+		return -1
+	}, tag)
+	levels := slices.DeleteFunc(strings.Split(tag, TagSeparator), func(level string) bool { return level == "" })
+	tag = strings.Join(levels, TagSeparator)
+	if runes := []rune(tag); len(runes) > MaxTagLength {
+		tag = strings.TrimRight(string(runes[:MaxTagLength]), TagSeparator)
+	}
+	return tag
+}
+
+// TagAncestors returns the tags above a hierarchical tag, closest last.
+// For example the ancestors of lang/go/generics are lang and lang/go.
+func TagAncestors(tag string) []string {
+	ancestors := []string{}
+	for i, r := range tag {
+		if string(r) == TagSeparator && i > 0 {
+			ancestors = append(ancestors, tag[:i])
+		}
+	}
+	return ancestors
+}
+
+// TagIsUnder returns true if the tag is the parent tag or one of its descendants.
+// For example lang/go/generics is under lang/go but lang/gopher is not.
+func TagIsUnder(tag, parent string) bool {
+	return tag == parent || strings.HasPrefix(tag, parent+TagSeparator)
+}
+
+// CompareTags orders tags so each tag comes right before its descendants.
+// Returns -1, 0 or 1 like strings.Compare.
+func CompareTags(a, b string) int {
+	return slices.Compare(strings.Split(a, TagSeparator), strings.Split(b, TagSeparator))
+}
+
+// HasTagUnder returns true if the section has a tag that is one of the tags or one of their descendants.
+// The section's tags are resolved with Vocabulary first, so aliases that have not been normalized match.
+func (s *Section) HasTagUnder(tags []string) bool {
+	values, ok := s.FieldValues("tags")
+	if !ok {
+		return false
+	}
+	for _, value := range values {
+		value = ResolveTag(value)
+		for _, tag := range tags {
+			if TagIsUnder(value, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
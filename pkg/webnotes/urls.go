@@ -0,0 +1,131 @@
+package webnotes
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DefaultTrackingParams are the query parameters that are removed from URLs by default.
+// A name ending in * matches every parameter starting with the rest of the name.
+var DefaultTrackingParams = []string{
+	"_hsenc", "_hsmi", "fbclid", "gclid", "igshid", "mc_cid", "mc_eid", "msclkid", "ref_src", "utm_*", "yclid",
+}
+
+// Struct for the rules used to compare and clean up URLs.
+//
+// Normalize makes the changes that never change the page a URL points to:
+// the scheme and host are lower cased, default ports are removed, an empty path becomes /,
+// and tracking query parameters and the fragment are removed.
+//
+// Canonicalize also ignores the differences that almost never matter:
+// http and https, a leading www. in the host, and a trailing slash on the path.
+// The Keep settings turn these off.
+type URLCanonicalizer struct {
+	KeepScheme        bool     `toml:"keep_scheme"`
+	KeepWWW           bool     `toml:"keep_www"`
+	KeepTrailingSlash bool     `toml:"keep_trailing_slash"`
+	KeepFragment      bool     `toml:"keep_fragment"`
+	TrackingParams    []string `toml:"tracking_params"`
+}
+
+// NewURLCanonicalizer returns a URLCanonicalizer with the default rules.
+func NewURLCanonicalizer() *URLCanonicalizer {
+	return &URLCanonicalizer{TrackingParams: DefaultTrackingParams}
+}
+
+// Canonicalizer is the URLCanonicalizer used to decide if sections have the same URL.
+var Canonicalizer *URLCanonicalizer = NewURLCanonicalizer()
+
+// CanonicalURL returns the canonical form of a URL using Canonicalizer.
+// URLs with the same canonical form are considered the same URL.
+func CanonicalURL(rawURL string) string {
+	return Canonicalizer.Canonicalize(rawURL)
+}
+
+// isTrackingParam returns true if the query parameter name is a tracking parameter.
+func (c *URLCanonicalizer) isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, param := range c.TrackingParams {
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// parse returns the normalized parts of a URL.
+// Returns (*url.URL, true) for http and https URLs.
+// Returns (nil, false) for anything else, which is left as is.
+func (c *URLCanonicalizer) parse(rawURL string) (*url.URL, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" || u.Opaque != "" {
+		return nil, false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, false
+	}
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+	if u.RawQuery != "" {
+		// the kept parameters are not re-encoded or reordered
+		kept := []string{}
+		for _, param := range strings.Split(u.RawQuery, "&") {
+			name, _, _ := strings.Cut(param, "=")
+			if unescaped, err := url.QueryUnescape(name); err == nil {
+				name = unescaped
+			}
+			if param != "" && !c.isTrackingParam(name) {
+				kept = append(kept, param)
+			}
+		}
+		u.RawQuery = strings.Join(kept, "&")
+	}
+	u.ForceQuery = false
+	if !c.KeepFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	return u, true
+}
+
+// Normalize returns the URL with the changes that never change the page it points to.
+// URLs that are not http or https URLs are returned as is.
+func (c *URLCanonicalizer) Normalize(rawURL string) string {
+	u, ok := c.parse(rawURL)
+	if !ok {
+		return rawURL
+	}
+	return u.String()
+}
+
+// Canonicalize returns the form of the URL used to compare it to other URLs.
+// The canonical form is not meant to be shown or fetched.
+// URLs that are not http or https URLs are returned as is.
+func (c *URLCanonicalizer) Canonicalize(rawURL string) string {
+	u, ok := c.parse(rawURL)
+	if !ok {
+		return rawURL
+	}
+	if !c.KeepScheme {
+		u.Scheme = "https"
+	}
+	if !c.KeepWWW {
+		u.Host = strings.TrimPrefix(u.Host, "www.")
+	}
+	if !c.KeepTrailingSlash {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = strings.TrimSuffix(u.RawPath, "/")
+	}
+	return u.String()
+}
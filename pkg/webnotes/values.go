@@ -0,0 +1,226 @@
+package webnotes
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// The first line of a webnote file that uses format version 2.
+// Files without it are format version 1.
+//
+// In format version 1, header values are written as is and list values are separated by commas.
+//
+// Format version 2 adds:
+//   - quoted values: a value starting with " is a quoted string that can use the
+//     escapes \" \\ \n \r and \t, which lets list values contain commas
+//   - continuation lines: a header line followed by lines starting with a space
+//     continues the header value, with a newline between each line
+//
+// Webnote files are written in format version 2 only if a value needs it, see fieldNeedsVersion2,
+// so saving a version 1 file does not change how its values are written.
+const formatVersion2Line string = "# webnotes format 2"
+
+// valueIsPlain returns true if a value can be written without quoting.
+// List values can not contain commas.
+func valueIsPlain(value string, list bool) bool {
+	if value == "" || strings.HasPrefix(value, "\"") {
+		return false
+	}
+	if strings.TrimSpace(value) != value {
+		return false
+	}
+	if list && strings.Contains(value, ",") {
+		return false
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// valueCanContinue returns true if a multi-line value can be written with continuation lines.
+func valueCanContinue(value string) bool {
+	if !strings.Contains(value, "\n") {
+		return false
+	}
+	for _, line := range strings.Split(value, "\n") {
+		if !valueIsPlain(line, false) {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteValue returns a value as a quoted string.
+func quoteValue(value string) string {
+	var b strings.Builder
+	b.WriteString("\"")
+	for _, r := range value {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString("\"")
+	return b.String()
+}
+
+// unquoteValue reads a quoted string from the start of s.
+// Returns (value, rest_of_s, nil) on success.
+// Returns ("", "", *valueError) if the quoted string is invalid.
+func unquoteValue(s string) (string, string, error) {
+	if !strings.HasPrefix(s, "\"") {
+		return "", "", &valueError{"Quoted value must start with \"", 0}
+	}
+	var b strings.Builder
+	escaped := false
+	for i, r := range s[1:] {
+		if escaped {
+			switch r {
+			case '"', '\\':
+				b.WriteRune(r)
+			case 'n':
+				b.WriteRune('\n')
+			case 'r':
+				b.WriteRune('\r')
+			case 't':
+				b.WriteRune('\t')
+			default:
+				return "", "", &valueError{"Invalid escape in quoted value", i}
+			}
+			escaped = false
+		} else if r == '\\' {
+			escaped = true
+		} else if r == '"' {
+			return b.String(), s[i+2:], nil
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return "", "", &valueError{"Unterminated quoted value", 0}
+}
+
+// fieldNeedsVersion2 returns true if a field can not be written in format version 1,
+// where values are written as is, list values are joined with commas and a header line can not
+// have newlines or end with whitespace.
+func fieldNeedsVersion2(field *Field) bool {
+	value := strings.Join(field.Values, ",")
+	if value == "" || strings.TrimRightFunc(value, unicode.IsSpace) != value {
+		return true
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return true
+		}
+	}
+	if !slices.Contains(singletonFieldNames, field.Name) {
+		for _, v := range field.Values {
+			if strings.Contains(v, ",") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// formatFieldLines returns the lines for a field in a webnote file of the format version.
+// In version 1 values are written as is, so fields that need version 2 must not be written with it.
+func formatFieldLines(field *Field, version int) []string {
+	prefix := field.Name + ": "
+	if version < 2 {
+		return []string{prefix + strings.Join(field.Values, ",")}
+	}
+	if slices.Contains(singletonFieldNames, field.Name) {
+		value := strings.Join(field.Values, ",")
+		if valueIsPlain(value, false) {
+			return []string{prefix + value}
+		}
+		if valueCanContinue(value) {
+			lines := strings.Split(value, "\n")
+			for i := 1; i < len(lines); i++ {
+				lines[i] = " " + lines[i]
+			}
+			lines[0] = prefix + lines[0]
+			return lines
+		}
+		return []string{prefix + quoteValue(value)}
+	}
+	values := make([]string, 0, len(field.Values))
+	for _, value := range field.Values {
+		if valueIsPlain(value, true) {
+			values = append(values, value)
+		} else {
+			values = append(values, quoteValue(value))
+		}
+	}
+	return []string{prefix + strings.Join(values, ",")}
+}
+
+// parseFieldValues parses the value of a header line.
+// version is the format version of the file being parsed.
+// Returns ([]values, nil) on success.
+// Returns (nil, *valueError) on failure.
+func parseFieldValues(name, value string, version int) ([]string, error) {
+	singleton := slices.Contains(singletonFieldNames, name)
+	if version < 2 {
+		if singleton {
+			return []string{value}, nil
+		}
+		return strings.Split(value, ","), nil
+	}
+	if singleton {
+		if !strings.HasPrefix(value, "\"") {
+			return []string{value}, nil
+		}
+		unquoted, rest, err := unquoteValue(value)
+		if err != nil {
+			return nil, err
+		}
+		if rest != "" {
+			return nil, &valueError{"Unexpected text after quoted value", len(value) - len(rest)}
+		}
+		return []string{unquoted}, nil
+	}
+	values := []string{}
+	offset := 0
+	for {
+		if strings.HasPrefix(value, "\"") {
+			unquoted, rest, err := unquoteValue(value)
+			if err != nil {
+				err.(*valueError).offset += offset
+				return nil, err
+			}
+			values = append(values, unquoted)
+			if rest == "" {
+				return values, nil
+			}
+			offset += len(value) - len(rest)
+			if !strings.HasPrefix(rest, ",") {
+				return nil, &valueError{"Unexpected text after quoted value", offset}
+			}
+			value = rest[1:]
+			offset++
+		} else {
+			i := strings.Index(value, ",")
+			if i < 0 {
+				return append(values, value), nil
+			}
+			values = append(values, value[:i])
+			value = value[i+1:]
+			offset += i + 1
+		}
+	}
+}
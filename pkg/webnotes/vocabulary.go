@@ -0,0 +1,139 @@
+package webnotes
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Ways of handling tags that are not in the vocabulary when they are added.
+const (
+	UnknownTagsAllow  string = "allow"
+	UnknownTagsWarn   string = "warn"
+	UnknownTagsReject string = "reject"
+)
+
+// Struct for a tag in a tag vocabulary.
+type VocabularyTag struct {
+	Aliases     []string `toml:"aliases"`
+	Description string   `toml:"description"`
+}
+
+// Struct for a controlled vocabulary of tags.
+// Tags are the canonical tags, aliases are other ways of writing them.
+// Tags and aliases are matched without regard to case.
+//
+// For example:
+//
+//	[tags.javascript]
+//	aliases = ["js", "ecmascript"]
+//	description = "The JavaScript language"
+//
+//	[tags."lang/go"]
+//	aliases = ["go", "golang"]
+type TagVocabulary struct {
+	FilePath string                    `toml:"-"`
+	Tags     map[string]*VocabularyTag `toml:"tags"`
+	// lower cased tags and aliases to canonical tags
+	canonical map[string]string
+}
+
+// Vocabulary is the tag vocabulary tags are resolved with.
+// It is nil if there is no vocabulary.
+var Vocabulary *TagVocabulary
+
+// LoadTagVocabulary loads a tag vocabulary file.
+// Returns (*TagVocabulary, nil) on success.
+// Returns (nil, error) if the file cannot be read, has unknown settings, has an invalid tag, or an alias is used twice.
+func LoadTagVocabulary(filePath string) (*TagVocabulary, error) {
+	v := &TagVocabulary{}
+	md, err := toml.DecodeFile(filePath, v)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid tag vocabulary %s: %s", filePath, err))
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := []string{}
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return nil, errors.New(fmt.Sprintf("Unknown settings in tag vocabulary %s: %s", filePath, strings.Join(keys, ", ")))
+	}
+	v.FilePath = filePath
+	v.canonical = make(map[string]string)
+	add := func(name, tag string) error {
+		key := strings.ToLower(name)
+		if other, ok := v.canonical[key]; ok && other != tag {
+			return errors.New(fmt.Sprintf("Tag vocabulary %s uses %s for both %s and %s", filePath, name, other, tag))
+		}
+		v.canonical[key] = tag
+		return nil
+	}
+	for tag := range v.Tags {
+		if err := ValidateTag(tag); err != nil {
+			return nil, errors.New(fmt.Sprintf("Tag vocabulary %s: %s", filePath, err))
+		}
+		if err := add(tag, tag); err != nil {
+			return nil, err
+		}
+	}
+	for tag, vt := range v.Tags {
+		if vt == nil {
+			v.Tags[tag] = &VocabularyTag{}
+			continue
+		}
+		for _, alias := range vt.Aliases {
+			if err := add(alias, tag); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// Canonical returns the canonical form of a tag.
+// Returns (canonical_tag, true) if the tag or an alias of it is in the vocabulary.
+// Returns (tag, false) otherwise.
+func (v *TagVocabulary) Canonical(tag string) (string, bool) {
+	canonical, ok := v.canonical[strings.ToLower(tag)]
+	if !ok {
+		return tag, false
+	}
+	return canonical, true
+}
+
+// Unknown returns the tags that are not in the vocabulary.
+func (v *TagVocabulary) Unknown(tags []string) []string {
+	unknown := []string{}
+	for _, tag := range tags {
+		if _, ok := v.Canonical(tag); !ok {
+			unknown = append(unknown, tag)
+		}
+	}
+	return unknown
+}
+
+// ResolveTag returns the canonical form of a tag using Vocabulary.
+// The tag is returned as is if there is no vocabulary or the tag is not in it.
+func ResolveTag(tag string) string {
+	if Vocabulary == nil {
+		return tag
+	}
+	canonical, _ := Vocabulary.Canonical(tag)
+	return canonical
+}
+
+// ResolveTags returns the canonical forms of tags using Vocabulary.
+// Tags that resolve to the same tag are only returned once.
+func ResolveTags(tags []string) []string {
+	resolved := []string{}
+	for _, tag := range tags {
+		tag = ResolveTag(tag)
+		if !slices.Contains(resolved, tag) {
+			resolved = append(resolved, tag)
+		}
+	}
+	return resolved
+}
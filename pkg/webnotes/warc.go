@@ -0,0 +1,288 @@
+package webnotes
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WARCPath      string = "wn_warc"
+	warcIndexName string = "index"
+	warcVersion   string = "WARC/1.0"
+)
+
+// ErrWARCWrite is wrapped by errors from Fetcher.Get when archiving fails.
+var ErrWARCWrite = errors.New("Failed to write WARC record")
+
+// Struct for writing gzip'd WARC files.
+// Each record is written as its own gzip member so that a record can be read
+// starting from its offset in the file.
+type WARCWriter struct {
+	Dir      string
+	FilePath string
+	file     *os.File
+	offset   int64
+}
+
+// NewWARCWriter returns a WARCWriter that writes to a new WARC file in dir.
+// The directory is created if it does not exist.
+// Returns (*WARCWriter, nil) on success.
+// Returns (nil, error) on failure.
+func NewWARCWriter(dir string) (*WARCWriter, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s.warc.gz", time.Now().UTC().Format("20060102150405.000000000"))
+	filePath := filepath.Join(dir, name)
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	ww := &WARCWriter{dir, filePath, file, 0}
+	info := "software: webnotes\r\nformat: WARC File Format 1.0\r\n"
+	header := warcHeader{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Date", warcDate(time.Now())},
+		{"WARC-Filename", name},
+		{"WARC-Record-ID", warcRecordID()},
+		{"Content-Type", "application/warc-fields"},
+	}
+	if _, err := ww.writeRecord(header, []byte(info)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return ww, nil
+}
+
+// Close closes the WARC file.
+func (ww *WARCWriter) Close() error {
+	return ww.file.Close()
+}
+
+// WriteExchange writes a request and response record for an HTTP exchange.
+// The response body must already have been read and is passed as body.
+// An entry mapping the URL to the offset of the response record is added to the WARC index.
+// Returns nil on success and error on failure.
+func (ww *WARCWriter) WriteExchange(req *http.Request, resp *http.Response, body []byte) error {
+	uri := req.URL.String()
+	date := warcDate(time.Now())
+	reqID := warcRecordID()
+	respID := warcRecordID()
+	var reqBuf bytes.Buffer
+	if err := req.Write(&reqBuf); err != nil {
+		return err
+	}
+	var respBuf bytes.Buffer
+	if err := rawResponse(resp, body).Write(&respBuf); err != nil {
+		return err
+	}
+	header := warcHeader{
+		{"WARC-Type", "request"},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", uri},
+		{"WARC-Record-ID", reqID},
+		{"WARC-Concurrent-To", respID},
+		{"Content-Type", "application/http;msgtype=request"},
+	}
+	if _, err := ww.writeRecord(header, reqBuf.Bytes()); err != nil {
+		return err
+	}
+	header = warcHeader{
+		{"WARC-Type", "response"},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", uri},
+		{"WARC-Record-ID", respID},
+		{"WARC-Concurrent-To", reqID},
+		{"Content-Type", "application/http;msgtype=response"},
+	}
+	offset, err := ww.writeRecord(header, respBuf.Bytes())
+	if err != nil {
+		return err
+	}
+	return AppendWARCIndex(ww.Dir, &WARCIndexEntry{uri, filepath.Base(ww.FilePath), offset})
+}
+
+// writeRecord writes a record as its own gzip member.
+// Returns (offset_of_record, nil) on success.
+// Returns (0, error) on failure.
+func (ww *WARCWriter) writeRecord(header warcHeader, block []byte) (int64, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	fmt.Fprintf(gz, "%s\r\n", warcVersion)
+	for _, h := range header {
+		fmt.Fprintf(gz, "%s: %s\r\n", h[0], h[1])
+	}
+	fmt.Fprintf(gz, "Content-Length: %d\r\n\r\n", len(block))
+	gz.Write(block)
+	io.WriteString(gz, "\r\n\r\n")
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+	offset := ww.offset
+	n, err := ww.file.Write(buf.Bytes())
+	ww.offset += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+type warcHeader [][2]string
+
+// warcDate formats a time the way WARC-Date expects.
+func warcDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// warcRecordID returns a new random WARC-Record-ID.
+func warcRecordID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// rawResponse returns a copy of resp with body as its body.
+// The net/http client removes transfer and content encodings, so the copy
+// describes the body as it was read.
+func rawResponse(resp *http.Response, body []byte) *http.Response {
+	raw := *resp
+	raw.Header = resp.Header.Clone()
+	if resp.Uncompressed {
+		raw.Header.Del("Content-Encoding")
+	}
+	raw.Header.Del("Content-Length")
+	raw.TransferEncoding = nil
+	raw.ContentLength = int64(len(body))
+	raw.Body = io.NopCloser(bytes.NewReader(body))
+	return &raw
+}
+
+// Structure for an entry of a WARC index.
+// File is the name of a WARC file in the WARC directory.
+// Offset is where the response record for URL starts in File.
+type WARCIndexEntry struct {
+	URL    string
+	File   string
+	Offset int64
+}
+
+// AppendWARCIndex adds an entry to the index in the WARC directory.
+// Returns nil on success and error on failure.
+func AppendWARCIndex(dir string, entry *WARCIndexEntry) error {
+	filePath := filepath.Join(dir, warcIndexName)
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "%s %d %s\n", entry.File, entry.Offset, entry.URL)
+	return err
+}
+
+// LoadWARCIndex loads the index in the WARC directory.
+// Returns ([]*WARCIndexEntry, nil) on success.
+// Returns (nil, error) on failure.
+func LoadWARCIndex(dir string) ([]*WARCIndexEntry, error) {
+	lines, err := LoadFile(filepath.Join(dir, warcIndexName))
+	if err != nil {
+		return nil, err
+	}
+	index := []*WARCIndexEntry{}
+	for _, line := range lines {
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) != 3 {
+			return nil, errors.New("Invalid WARC index line")
+		}
+		offset, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		index = append(index, &WARCIndexEntry{parts[2], parts[0], offset})
+	}
+	return index, nil
+}
+
+// LatestWARCEntry returns the most recently archived entry for the URL.
+// Returns (*WARCIndexEntry, true) if the URL has been archived.
+// Returns (nil, false) if it has not.
+func LatestWARCEntry(index []*WARCIndexEntry, url string) (*WARCIndexEntry, bool) {
+	for i := len(index) - 1; i >= 0; i-- {
+		if index[i].URL == url {
+			return index[i], true
+		}
+	}
+	return nil, false
+}
+
+// ReadWARCResponse reads the archived HTTP response for an index entry.
+// The caller must close the body of the returned response.
+// Returns (*http.Response, nil) on success.
+// Returns (nil, error) on failure.
+func ReadWARCResponse(dir string, entry *WARCIndexEntry) (*http.Response, error) {
+	file, err := os.Open(filepath.Join(dir, filepath.Base(entry.File)))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(entry.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	gz.Multistream(false)
+	record, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(bytes.NewReader(record))
+	version, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(version) != warcVersion {
+		return nil, errors.New("Invalid WARC record")
+	}
+	isResponse := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if line == "WARC-Type: response" {
+			isResponse = true
+		}
+	}
+	if !isResponse {
+		return nil, errors.New("WARC record is not a response")
+	}
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
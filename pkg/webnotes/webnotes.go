@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -26,17 +25,20 @@ import (
 )
 
 const (
-	IndexPath string = "wn_index"
-	fileStart int    = 0
-	inHeader  int    = 1
-	inBody    int    = 2
+	fileStart int = 0
+	inHeader  int = 1
+	inBody    int = 2
 )
 
+// IndexPath is the directory BuildIndex writes the index to.
+// It can be set by the index_path setting of the configuration file.
+var IndexPath string = "wn_index"
+
 // The order to put a section's fields in when writing a webnote file.
-var orderedFieldNames []string = []string{"title", "description", "author", "date", "tags", "status", "error"}
+var orderedFieldNames []string = []string{"title", "description", "author", "date", "tags", "type", "mime", "dimensions", "status", "error"}
 
 // These fields can have only one value (they are not lists).
-var singletonFieldNames []string = []string{"author", "date", "description", "error", "status", "title"}
+var singletonFieldNames []string = []string{"author", "date", "description", "dimensions", "error", "mime", "status", "title", "type"}
 
 // Struct for a section's header fields.
 type Field struct {
@@ -62,6 +64,25 @@ func (f *Field) Add(f2 *Field) {
 	}
 }
 
+// Struct for a range of lines in a webnote file.
+// Line numbers start at 1.
+// Start is 0 if the lines are not known.
+type Lines struct {
+	Start int
+	End   int
+}
+
+// Struct for where a section was in the webnote file it was loaded from.
+// Section goes from the section's first line to its last non-blank line.
+// Fields has the lines of each header field, including continuation lines.
+// For duplicate fields, the lines of the first field are kept.
+// Body goes from the first to the last non-blank line of the body and is zero if the body is blank.
+type SectionLines struct {
+	Section Lines
+	Fields  map[string]Lines
+	Body    Lines
+}
+
 // Struct for a section of a webnote file.
 // One of Note or URL should be set.
 type Section struct {
@@ -217,25 +238,42 @@ func (s *Section) Add(s2 *Section) {
 }
 
 // AddTag adds the provided tag to the section.
+// The tag is normalized with NormalizeTag and an alias is resolved to its canonical tag with Vocabulary.
 // Duplicate tags are removed.
-func (s *Section) AddTag(tag string) {
+// Returns nil on success.
+// Returns error if the tag is invalid.
+func (s *Section) AddTag(tag string) error {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	tag = ResolveTag(tag)
 	field, ok := s.Field("tags")
 	if !ok {
 		s.AddField("tags", []string{tag})
-		return
+		return nil
 	}
 	field.Values = append(field.Values, tag)
 	// this gets rid of duplicates
 	slices.Sort[[]string](field.Values)
 	field.Values = slices.Compact[[]string, string](field.Values)
+	return nil
 }
 
 // AddTags adds the provided tags to the section.
 // Duplicate tags are removed.
-func (s *Section) AddTags(tags []string) {
+// Returns nil on success.
+// Returns error if a tag is invalid, in which case no tags are added.
+func (s *Section) AddTags(tags []string) error {
+	for _, tag := range tags {
+		if _, err := NormalizeTag(tag); err != nil {
+			return err
+		}
+	}
 	for _, tag := range tags {
 		s.AddTag(tag)
 	}
+	return nil
 }
 
 // AddField adds the to the section.
@@ -458,21 +496,38 @@ func (s *Section) FillFieldValue(name string, value string) {
 // Anything besides a 200 status code for the request is considered an error.
 // Sets the section's status if for status codes other than 200.
 // Sets the section's error if there is some error (besides an unexpected status).
+// The document is fetched with DefaultFetcher.
+// The document is transcoded to UTF-8 before it is parsed.
+// PDF, plain text and image documents are turned into simple HTML documents
+// and the section's type field is set to the type of document.
+// For images, the section's mime and dimensions fields are also set.
 func (s *Section) Get() (*goquery.Document, error) {
 	if s.URL == "" {
 		return nil, errors.New("Section does not have a url")
 	}
-	resp, err := http.Get(s.URL)
-	if err != nil {
+	resp, body, err := DefaultFetcher.Get(s.URL)
+	if errors.Is(err, ErrWARCWrite) || errors.Is(err, ErrNotCached) {
+		return nil, err
+	} else if err != nil {
 		s.SetError(err)
 		return nil, err
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
 		s.SetStatus(resp.Status)
 		return nil, errors.New("Failed to get document")
 	}
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	contentType := resp.Header.Get("Content-Type")
+	var doc *goquery.Document
+	switch documentType, mimeType := DocumentType(contentType, body); documentType {
+	case DocumentImage:
+		doc, err = s.imageContent(body, mimeType)
+	case DocumentPDF:
+		doc, err = s.pdfContent(body)
+	case DocumentText:
+		doc, err = s.textContent(body, contentType)
+	default:
+		doc, err = s.htmlContent(body, contentType)
+	}
 	if err != nil {
 		s.SetError(err)
 		return nil, err
@@ -495,12 +550,13 @@ func (s *Section) HasField(name string) bool {
 // It sets the error field for the section if there is an error.
 // It sets the status for the section on status codes besides a 200.
 // On a successful head, it deltes the error and status fields of the section.
+// The head is done with DefaultFetcher.
 func (s *Section) Head() {
 	if s.URL == "" {
 		s.SetError(errors.New("Section does not have a url"))
 		return
 	}
-	resp, err := http.Head(s.URL)
+	resp, err := DefaultFetcher.Head(s.URL)
 	if err != nil {
 		s.SetError(err)
 	} else if resp.StatusCode == 200 {
@@ -543,18 +599,47 @@ func (s *Section) ID() (string, error) {
 	}
 }
 
+// CanonicalID returns the section's ID with the URL in its canonical form.
+// Sections that match have the same canonical ID.
+// Returns (id, nil) on success.
+// Returns ("", error) on error.
+func (s *Section) CanonicalID() (string, error) {
+	id, err := s.ID()
+	if err != nil || s.URL == "" {
+		return id, err
+	}
+	return CanonicalURL(id), nil
+}
+
 // Matches returns true if the two sections match.
-// Matching means their Notes or URLs match.
+// Matching means their Notes or the canonical forms of their URLs match.
 func (s *Section) Matches(s2 *Section) bool {
 	if s.Note != "" {
 		return s.Note == s2.Note
 	} else if s.URL != "" {
-		return s.URL == s2.URL
+		return s2.URL != "" && CanonicalURL(s.URL) == CanonicalURL(s2.URL)
 	} else {
 		return s2.Note == "" && s2.URL == ""
 	}
 }
 
+// RenameTags replaces the from tags the section has with the to tag.
+// Several tags can be merged into one this way.
+// The from tags are matched as they are, so invalid tags can be renamed.
+// Returns (true, nil) if the section had any of the from tags.
+// Returns (false, nil) if it had none of them.
+// Returns (false, error) if the to tag is invalid.
+func (s *Section) RenameTags(from []string, to string) (bool, error) {
+	if _, err := NormalizeTag(to); err != nil {
+		return false, err
+	}
+	if len(from) == 0 || !s.FieldHasValue("tags", from) {
+		return false, nil
+	}
+	s.DeleteTags(from)
+	return true, s.AddTag(to)
+}
+
 // SetBody sets the section's body.
 func (s *Section) SetBody(lines []string) {
 	s.Body = lines
@@ -599,17 +684,46 @@ func (s *Section) SetStatus(status string) {
 }
 
 // SetTags sets the tags field for the section to the provided slice of values.
-func (s *Section) SetTags(tags []string) {
-	if len(tags) == 0 {
+// Tags are normalized with NormalizeTag, aliases are resolved to canonical tags with Vocabulary
+// and tags that resolve to the same tag are only set once.
+// Returns nil on success.
+// Returns error if a tag is invalid, in which case the tags are not changed.
+func (s *Section) SetTags(tags []string) error {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag, err := NormalizeTag(tag)
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) == 0 {
 		s.DeleteField("tags")
 	} else {
-		s.SetFieldValues("tags", tags)
+		s.SetFieldValues("tags", ResolveTags(normalized))
 	}
+	return nil
 }
 
 // String returns a string value of the section.
 // The string is suitable for writing to a webnote file.
 func (s *Section) String() string {
+	return s.format(s.formatVersion())
+}
+
+// formatVersion returns the format version the section needs to be written in,
+// 2 if any of its fields can not be written in version 1 and 1 otherwise.
+func (s *Section) formatVersion() int {
+	for _, field := range s.Fields {
+		if len(field.Values) > 0 && fieldNeedsVersion2(field) {
+			return 2
+		}
+	}
+	return 1
+}
+
+// format returns a string value of the section for a webnote file of the format version.
+func (s *Section) format(version int) string {
 	lines := make([]string, 0)
 	if s.Note != "" {
 		lines = append(lines, fmt.Sprintf("# note://%s", s.Note))
@@ -626,7 +740,7 @@ func (s *Section) String() string {
 				slices.Sort[[]string](field.Values)
 			}
 			if len(field.Values) > 0 {
-				lines = append(lines, fmt.Sprintf("%s: %s", field.Name, strings.Join(field.Values, ",")))
+				lines = append(lines, formatFieldLines(field, version)...)
 			}
 		}
 	}
@@ -635,7 +749,7 @@ func (s *Section) String() string {
 			continue
 		}
 		if len(field.Values) > 0 {
-			lines = append(lines, fmt.Sprintf("%s: %s", field.Name, strings.Join(field.Values, ",")))
+			lines = append(lines, formatFieldLines(field, version)...)
 		}
 	}
 	inBody := false
@@ -665,14 +779,23 @@ func (s *Section) String() string {
 // Struct for a webnote file.
 // FilePath is the path on disk for the file.
 // Sections is a slice of the sections of th WebNote in order.
+// Lines has where each section was in the file for WebNotes loaded from a file.
+// Lines are not updated when sections are changed.
 type WebNote struct {
 	FilePath string
 	Sections []*Section
+	Lines    map[*Section]*SectionLines
 }
 
 // NewWebNote returns an initialized WebNote.
 func NewWebNote(filePath string) *WebNote {
-	return &WebNote{filePath, make([]*Section, 0)}
+	return &WebNote{filePath, make([]*Section, 0), make(map[*Section]*SectionLines)}
+}
+
+// SectionLines returns where a section was in the file the WebNote was loaded from.
+// Returns nil if the section was not loaded from the file.
+func (wn *WebNote) SectionLines(section *Section) *SectionLines {
+	return wn.Lines[section]
 }
 
 // AddSection adds a seciton to the WebNote.
@@ -703,41 +826,119 @@ func formatNoteString(noteString string) (string, error) {
 }
 
 // LoadWebNote file loads a WebNote from the filePath provided.
+// Files in format version 1 and 2 are loaded.
 // Returns (*WebNote, nil) on success.
 // Returns (nil, error) on failure.
+// Loading stops at the first error in the file.
 func LoadWebNote(filePath string) (*WebNote, error) {
-	file, err := os.Open(filePath)
+	wn, _, err := parseWebNote(filePath, false)
 	if err != nil {
 		return nil, err
 	}
+	return wn, nil
+}
+
+// parseWebNote parses a webnote file.
+// If tolerant is false, parsing stops with an error at the first error diagnostic.
+// If tolerant is true, parsing continues past problems and all diagnostics are returned.
+// Returns (*WebNote, []*Diagnostic, nil) on success.
+// Returns (nil, nil, error) on failure.
+func parseWebNote(filePath string, tolerant bool) (*WebNote, []*Diagnostic, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer file.Close()
+	diagnostics := []*Diagnostic{}
+	report := func(lineNumber, column int, severity, message string) error {
+		diagnostics = append(diagnostics, &Diagnostic{filePath, lineNumber, column, severity, message})
+		if !tolerant && severity == SeverityError {
+			return errorWithLineNumber(errors.New(message), lineNumber)
+		}
+		return nil
+	}
 	webNote := NewWebNote(filePath)
 	parseState := fileStart
+	version := 1
 	var section *Section
+	var lines *SectionLines
+	// a header line is added to the section once all of its continuation lines are read
+	var headerName, headerValue string
+	headerLineNumber, headerEndLineNumber := 0, 0
+	addHeader := func() error {
+		if headerLineNumber == 0 {
+			return nil
+		}
+		lineNumber := headerLineNumber
+		headerLineNumber = 0
+		values, err := parseFieldValues(headerName, headerValue, version)
+		if err != nil {
+			line, column := headerValuePosition(headerName, headerValue, err)
+			return report(lineNumber+line, column, SeverityError, err.Error())
+		}
+		if section.HasField(headerName) {
+			report(lineNumber, 1, SeverityWarning, fmt.Sprintf("Duplicate %s field", headerName))
+		}
+		if headerName == "tags" {
+			// ParseWebNote still loads invalid tags so they can be fixed
+			for _, tag := range values {
+				if err := ValidateTag(tag); err != nil {
+					if err := report(lineNumber, 1, SeverityError, err.Error()); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		section.AddField(headerName, values)
+		if _, ok := lines.Fields[headerName]; !ok {
+			lines.Fields[headerName] = Lines{lineNumber, headerEndLineNumber}
+		}
+		lines.Section.End = headerEndLineNumber
+		return nil
+	}
+	reportedStart := false
 	lineNumber := 0
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
 		line = strings.TrimRightFunc(line, unicode.IsSpace)
 		lineNumber += 1
-		if strings.HasPrefix(line, "# note://") {
+		if parseState == inHeader && version >= 2 && headerLineNumber > 0 && line != "" && (line[0] == ' ' || line[0] == '\t') {
+			headerValue += "\n" + line[1:]
+			headerEndLineNumber = lineNumber
+			continue
+		}
+		if err := addHeader(); err != nil {
+			return nil, nil, err
+		}
+		if parseState == fileStart && lineNumber == 1 && line == formatVersion2Line {
+			version = 2
+		} else if strings.HasPrefix(line, "# note://") {
 			webNote.formatLastSection()
 			noteString, err := formatNoteString(line[len("# note://"):])
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			section, err = NewSection(noteString, "")
 			if err != nil {
-				return nil, err
+				if err := report(lineNumber, 1, SeverityError, "Invalid note section line"); err != nil {
+					return nil, nil, err
+				}
+				section, parseState = nil, fileStart
+				continue
 			}
+			lines = &SectionLines{Lines{lineNumber, lineNumber}, make(map[string]Lines), Lines{}}
+			webNote.Lines[section] = lines
 			webNote.AddSection(section)
 			parseState = inHeader
 		} else if strings.HasPrefix(line, "# http://") || strings.HasPrefix(line, "# https://") {
 			webNote.formatLastSection()
 			section, err = NewSection("", line[len("# "):])
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
+			lines = &SectionLines{Lines{lineNumber, lineNumber}, make(map[string]Lines), Lines{}}
+			webNote.Lines[section] = lines
 			webNote.AddSection(section)
 			parseState = inHeader
 		} else if parseState == inHeader {
@@ -746,28 +947,43 @@ func LoadWebNote(filePath string) (*WebNote, error) {
 			} else {
 				parts := strings.SplitN(line, ": ", 2)
 				if len(parts) != 2 {
-					return nil, errorWithLineNumber(errors.New("Invalid header line"), lineNumber)
-				}
-				var values []string
-				if slices.Contains(singletonFieldNames, parts[0]) {
-					values = []string{parts[1]}
-				} else {
-					values = strings.Split(parts[1], ",")
-				}
-				if len(values) == 0 {
-					return nil, errorWithLineNumber(errors.New("Invalid header line"), lineNumber)
+					if err := report(lineNumber, 1, SeverityError, "Invalid header line"); err != nil {
+						return nil, nil, err
+					}
+					continue
 				}
-				section.AddField(parts[0], values)
+				headerName, headerValue = parts[0], parts[1]
+				headerLineNumber, headerEndLineNumber = lineNumber, lineNumber
 			}
 		} else if parseState == inBody {
 			section.AppendBody(line)
+			if line != "" {
+				if lines.Body.Start == 0 {
+					lines.Body.Start = lineNumber
+				}
+				lines.Body.End = lineNumber
+				lines.Section.End = lineNumber
+			}
 		} else if parseState == fileStart {
-			return nil, errorWithLineNumber(errors.New("Unexpected start to web note file"), lineNumber)
+			if !reportedStart {
+				if err := report(lineNumber, 1, SeverityError, "Unexpected start to web note file"); err != nil {
+					return nil, nil, err
+				}
+				reportedStart = true
+			}
 		} else {
-			return nil, errorWithLineNumber(errors.New("Unexpected parsing error"), lineNumber)
+			if err := report(lineNumber, 1, SeverityError, "Unexpected parsing error"); err != nil {
+				return nil, nil, err
+			}
 		}
 	}
-	return webNote, nil
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if err := addHeader(); err != nil {
+		return nil, nil, err
+	}
+	return webNote, diagnostics, nil
 }
 
 // errorWithLineNumber makes an error with a line number.
@@ -804,24 +1020,30 @@ func GetWebNoteFiles(directoryPath string) ([]string, error) {
 }
 
 // SaveWebNote file writes the WebNote to disk.
+// The file is written in format version 2 only if any of its values can not be written in version 1.
 // Returns nil on success and error on failure.
 func SaveWebNote(wn *WebNote) error {
+	version := 1
+	for _, section := range wn.Sections {
+		if section != nil {
+			version = max(version, section.formatVersion())
+		}
+	}
+	sections := []string{}
+	for _, section := range wn.Sections {
+		if section != nil {
+			sections = append(sections, section.format(version))
+		}
+	}
 	file, err := os.Create(wn.FilePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	wroteSection := false
-	for _, section := range wn.Sections {
-		if section == nil {
-			continue
-		}
-		if wroteSection {
-			file.WriteString("\n")
-		}
-		file.WriteString(section.String())
-		wroteSection = true
+	if version == 2 {
+		file.WriteString(formatVersion2Line + "\n")
 	}
+	file.WriteString(strings.Join(sections, "\n"))
 	return nil
 }
 
@@ -832,9 +1054,11 @@ type NameWebNote struct {
 }
 
 // Structure used when building a WebNote index.
+// Count is the number of sections in the entry's WebNote file.
 type IndexEntry struct {
-	Name string
-	MD5  string
+	Name  string
+	MD5   string
+	Count int
 }
 
 // Structure used when building a WebNote index.
@@ -847,42 +1071,55 @@ type FilePathNote struct {
 // IndexPath is removed if it exists.
 // IndexPath is created and the index is written there.
 // The current working directory is where WebNote files are searched for.
-func BuildIndex() error {
+// A section is in the tags index of each of its tags and of the tags above them, like lang for lang/go.
+// Files with errors are left out of the index rather than stopping it from being built.
+// Returns ([]*Diagnostic, nil) on success, with the error diagnostics of the files left out.
+// Returns (nil, error) on failure.
+func BuildIndex() ([]*Diagnostic, error) {
 	if stat, err := os.Stat(IndexPath); err == nil {
 		if stat.IsDir() {
 			if err := os.RemoveAll(IndexPath); err != nil {
-				return err
+				return nil, err
 			}
 		} else {
-			return errors.New(fmt.Sprintf("Error: %s file exists", IndexPath))
+			return nil, errors.New(fmt.Sprintf("Error: %s file exists", IndexPath))
 		}
 	}
 	indexDirs := []string{"authors", "hosts", "notes", "tags"}
 	for _, dir := range indexDirs {
 		indexDir := filepath.Join(IndexPath, dir)
 		if err := os.MkdirAll(indexDir, os.ModePerm); err != nil {
-			return err
+			return nil, err
 		}
 	}
 	files, err := GetWebNoteFiles(".")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	authors := make(map[string]*NameWebNote)
 	hosts := make(map[string]*NameWebNote)
 	notes := make(map[string]*FilePathNote)
 	tags := make(map[string]*NameWebNote)
+	skipped := []*Diagnostic{}
 	for _, filePath := range files {
-		wn, err := LoadWebNote(filePath)
+		wn, diagnostics, err := ParseWebNote(filePath)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if HasErrors(diagnostics) {
+			for _, d := range diagnostics {
+				if d.Severity == SeverityError {
+					skipped = append(skipped, d)
+				}
+			}
+			continue
 		}
 		for _, sct := range wn.Sections {
 			if sct.Note != "" {
 				key := fmt.Sprintf("%s#%s", filePath, sct.Note)
 				_, ok := notes[key]
 				if ok {
-					return errors.New(fmt.Sprintf("Found duplicate note section: %s", key))
+					return nil, errors.New(fmt.Sprintf("Found duplicate note section: %s", key))
 				}
 				notes[key] = &FilePathNote{filePath, sct.Note}
 			} else if sct.URL != "" {
@@ -898,7 +1135,7 @@ func BuildIndex() error {
 					ie.WebNote_.AddSection(sct)
 				}
 			} else {
-				return errors.New(fmt.Sprintf("Found section with neither note or url: %s", filePath))
+				return nil, errors.New(fmt.Sprintf("Found section with neither note or url: %s", filePath))
 			}
 			value, ok := sct.FieldValue("author")
 			if ok {
@@ -913,7 +1150,16 @@ func BuildIndex() error {
 			}
 			values, ok := sct.FieldValues("tags")
 			if ok {
+				// a section is also in the index of the tags above its tags, once
+				names := []string{}
 				for _, tag := range values {
+					for _, name := range append(TagAncestors(tag), tag) {
+						if !slices.Contains(names, name) {
+							names = append(names, name)
+						}
+					}
+				}
+				for _, tag := range names {
 					md5_ := fmt.Sprintf("%x", md5.Sum([]byte(tag)))
 					ie, ok := tags[md5_]
 					if !ok {
@@ -929,24 +1175,25 @@ func BuildIndex() error {
 	var filePath string
 	filePath = filepath.Join(IndexPath, "authors", "index")
 	if err := SaveIndexFile(filePath, authors); err != nil {
-		return err
+		return nil, err
 	}
 	filePath = filepath.Join(IndexPath, "hosts", "index")
 	if err := SaveIndexFile(filePath, hosts); err != nil {
-		return err
+		return nil, err
 	}
 	filePath = filepath.Join(IndexPath, "notes", "index")
 	if err := SaveNoteIndexFile(filePath, notes); err != nil {
-		return err
+		return nil, err
 	}
 	filePath = filepath.Join(IndexPath, "tags", "index")
 	if err := SaveIndexFile(filePath, tags); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return skipped, nil
 }
 
 // LoadIndexFile loads an index file.
+// Index files written before counts were stored load with a Count of 0.
 // Returns ([]*IndexEntry, nil) on success.
 // Returns (nil, error) on failure.
 func LoadIndexFile(filePath string) ([]*IndexEntry, error) {
@@ -963,7 +1210,15 @@ func LoadIndexFile(filePath string) ([]*IndexEntry, error) {
 		if len(parts) != 2 {
 			return nil, errors.New("Invalid index line")
 		}
-		index = append(index, &IndexEntry{parts[1], parts[0]})
+		md5_, value, ok := strings.Cut(parts[0], " ")
+		count := 0
+		if ok {
+			count, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, errors.New("Invalid index line")
+			}
+		}
+		index = append(index, &IndexEntry{parts[1], md5_, count})
 	}
 	return index, nil
 }
@@ -996,6 +1251,7 @@ func NameFromIndex(index []*IndexEntry, md5_ string) (string, error) {
 }
 
 // SaveIndexFile writes an index to a file.
+// Each line has the MD5 of a name, the number of sections of the name's WebNote and the name.
 // Returns nil on success.
 // Returns error on failure.
 func SaveIndexFile(filePath string, index map[string]*NameWebNote) error {
@@ -1005,19 +1261,21 @@ func SaveIndexFile(filePath string, index map[string]*NameWebNote) error {
 	}
 	defer file.Close()
 	type indexLine struct {
-		md5_ string
-		name string
+		md5_  string
+		count int
+		name  string
 	}
 	indexLines := make([]*indexLine, 0, len(index))
 	for md5_, ie := range index {
 		if err := SaveWebNote(ie.WebNote_); err != nil {
 			return err
 		}
-		indexLines = append(indexLines, &indexLine{md5_, ie.Name})
+		indexLines = append(indexLines, &indexLine{md5_, len(ie.WebNote_.Sections), ie.Name})
 	}
-	sort.Slice(indexLines, func(i, j int) bool { return indexLines[i].name < indexLines[j].name })
+	// hierarchical tags come right before their descendants
+	sort.Slice(indexLines, func(i, j int) bool { return CompareTags(indexLines[i].name, indexLines[j].name) < 0 })
 	for _, line := range indexLines {
-		fmt.Fprintf(file, "%s: %s\n", line.md5_, line.name)
+		fmt.Fprintf(file, "%s %d: %s\n", line.md5_, line.count, line.name)
 	}
 	return nil
 }
@@ -1062,11 +1320,29 @@ func FileExists(filePath string) (bool, error) {
 }
 
 // GetTags returns a list of tags from a tag string.
+// A tag string is a comma separated list of tags, like "go, web".
+// Tags are normalized with NormalizeTag and aliases are resolved to canonical tags with Vocabulary.
+// Returns ([]tags, nil) on success.
+// Returns (nil, error) if a tag is invalid.
+func GetTags(tagsString string) ([]string, error) {
+	tags, err := SplitTags(tagsString)
+	if err != nil {
+		return nil, err
+	}
+	for i, tag := range tags {
+		tags[i], err = NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ResolveTags(tags), nil
+}
+
+// SplitTags returns a list of tags from a tag string as they are written.
 // A tag string is a comma separated list of tags.
 // Returns ([]tags, nil) on success.
 // Returns (nil, error) on failure.
-// TODO: check for valid tag strings and return an error if an invalid tag is found.
-func GetTags(tagsString string) ([]string, error) {
+func SplitTags(tagsString string) ([]string, error) {
 	if len(tagsString) == 0 {
 		return make([]string, 0), nil
 	}
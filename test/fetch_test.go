@@ -0,0 +1,386 @@
+package test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	imagepng "image/png"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greglange/webnotes/pkg/webnotes"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func fakeResponse(req *http.Request, status int, contentType, body string) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{contentType}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// newTestFetcher returns a Fetcher that uses rt instead of the network.
+// robots.txt is not checked and requests are not rate limited.
+func newTestFetcher(rt roundTripFunc) *webnotes.Fetcher {
+	f := webnotes.NewFetcher()
+	f.Transport = rt
+	f.RobotsTxt = false
+	f.MinInterval = 0
+	return f
+}
+
+// withFetcher sets webnotes.DefaultFetcher to f for the duration of a test.
+func withFetcher(t *testing.T, f *webnotes.Fetcher) {
+	old := webnotes.DefaultFetcher
+	webnotes.DefaultFetcher = f
+	t.Cleanup(func() { webnotes.DefaultFetcher = old })
+}
+
+func TestFetcherGet(t *testing.T) {
+	var got *http.Request
+	f := newTestFetcher(func(req *http.Request) (*http.Response, error) {
+		got = req
+		return fakeResponse(req, 200, "text/html", "<html><head><title> Some  title </title></head></html>"), nil
+	})
+	f.UserAgent = "test-agent"
+	f.Headers["example.com"] = http.Header{"Authorization": []string{"Bearer token"}}
+	withFetcher(t, f)
+	sct, err := webnotes.NewSection("", "https://example.com/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := sct.Get()
+	if err != nil {
+		t.Fatalf("unexpected get failure: %s", err)
+	}
+	if title := webnotes.ContentTitle(doc); title != "Some title" {
+		t.Fatalf("unexpected title: %s", title)
+	}
+	if ua := got.Header.Get("User-Agent"); ua != "test-agent" {
+		t.Fatalf("unexpected user agent: %s", ua)
+	}
+	if auth := got.Header.Get("Authorization"); auth != "Bearer token" {
+		t.Fatalf("unexpected authorization header: %s", auth)
+	}
+}
+
+func TestFetcherMaxBodySize(t *testing.T) {
+	f := newTestFetcher(func(req *http.Request) (*http.Response, error) {
+		return fakeResponse(req, 200, "text/html", "<html>more than ten bytes</html>"), nil
+	})
+	f.MaxBodySize = 10
+	withFetcher(t, f)
+	sct, err := webnotes.NewSection("", "https://example.com/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sct.Get(); err == nil {
+		t.Fatal("expected get failure")
+	}
+	if !sct.HasField("error") {
+		t.Fatalf("expected error field: %s", sct)
+	}
+}
+
+func TestFetcherHead(t *testing.T) {
+	f := newTestFetcher(func(req *http.Request) (*http.Response, error) {
+		if req.Method != "HEAD" {
+			t.Fatalf("unexpected method: %s", req.Method)
+		}
+		resp := fakeResponse(req, 404, "text/html", "")
+		resp.Status = "404 Not Found"
+		return resp, nil
+	})
+	withFetcher(t, f)
+	sct, err := webnotes.NewSection("", "https://example.com/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct.Head()
+	if !sct.FieldEqualsValue("status", "404 Not Found") {
+		t.Fatalf("unexpected section content: %s", sct)
+	}
+}
+
+func TestFetcherCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	requests := 0
+	f := newTestFetcher(func(req *http.Request) (*http.Response, error) {
+		requests++
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			return fakeResponse(req, 304, "text/html", ""), nil
+		}
+		resp := fakeResponse(req, 200, "text/html", "<html><head><title>Cached</title></head></html>")
+		resp.Header.Set("ETag", `"v1"`)
+		return resp, nil
+	})
+	f.Cache = webnotes.NewHTTPCache(cacheDir, 0)
+	withFetcher(t, f)
+	for i := 0; i < 2; i++ {
+		_, body, err := f.Get("https://example.com/page")
+		if err != nil {
+			t.Fatalf("unexpected get failure: %s", err)
+		}
+		if !strings.Contains(string(body), "Cached") {
+			t.Fatalf("unexpected body: %s", body)
+		}
+	}
+	if requests != 2 {
+		t.Fatalf("expected 2 requests but got %d", requests)
+	}
+	f.Cache.Only = true
+	sct, err := webnotes.NewSection("", "https://example.com/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := sct.Get()
+	if err != nil {
+		t.Fatalf("unexpected cache only get failure: %s", err)
+	}
+	if title := webnotes.ContentTitle(doc); title != "Cached" {
+		t.Fatalf("unexpected title: %s", title)
+	}
+	if requests != 2 {
+		t.Fatalf("cache only mode made a request")
+	}
+	sct, err = webnotes.NewSection("", "https://example.com/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sct.Get(); err == nil {
+		t.Fatal("expected cache only get failure")
+	}
+	if sct.HasField("error") {
+		t.Fatalf("cache miss set error field: %s", sct)
+	}
+}
+
+func TestFetcherCharset(t *testing.T) {
+	type test struct {
+		encoding    encoding.Encoding
+		contentType string
+		meta        string
+		title       string
+	}
+	tests := []test{
+		{japanese.ShiftJIS, "text/html; charset=Shift_JIS", "", "日本語のページ"},
+		{charmap.Windows1251, "text/html", `<meta charset="windows-1251">`, "Русская страница"},
+		{charmap.ISO8859_1, "text/html; charset=iso-8859-1", "", "Café Société"},
+	}
+	for _, tc := range tests {
+		page, err := tc.encoding.NewEncoder().String("<html><head>" + tc.meta + "<title>" + tc.title + "</title></head></html>")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := newTestFetcher(func(req *http.Request) (*http.Response, error) {
+			return fakeResponse(req, 200, tc.contentType, page), nil
+		})
+		withFetcher(t, f)
+		sct, err := webnotes.NewSection("", "https://example.com/page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := sct.Get()
+		if err != nil {
+			t.Fatalf("unexpected get failure: %s", err)
+		}
+		if title := webnotes.ContentTitle(doc); title != tc.title {
+			t.Fatalf("unexpected title: %s", title)
+		}
+	}
+}
+
+func TestFetcherDocumentTypes(t *testing.T) {
+	var png bytes.Buffer
+	if err := imagepng.Encode(&png, image.NewRGBA(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	zw.Write([]byte("BT /F1 12 Tf 72 712 Td (First line) Tj T* [(Second) -300 (line)] TJ ET"))
+	zw.Close()
+	pdf := fmt.Sprintf("%%PDF-1.4\n1 0 obj\n<< /Title (Some PDF) >>\nendobj\n"+
+		"2 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\nendobj\ntrailer\n<< /Info 1 0 R >>\n%%%%EOF\n",
+		stream.Len(), stream.String())
+	type test struct {
+		url         string
+		contentType string
+		body        string
+		title       string
+		p           []string
+		fields      map[string]string
+	}
+	tests := []test{
+		{
+			"https://example.com/doc.pdf", "application/pdf", pdf, "Some PDF",
+			[]string{"First line", "", "Second line"},
+			map[string]string{"type": "pdf"},
+		},
+		{
+			"https://example.com/notes.txt", "text/plain; charset=utf-8", "One\ntwo\n\nThree\n", "notes.txt",
+			[]string{"One two", "", "Three"},
+			map[string]string{"type": "text"},
+		},
+		{
+			"https://example.com/image.png", "", png.String(), "image.png",
+			[]string{},
+			map[string]string{"type": "image", "mime": "image/png", "dimensions": "3x2"},
+		},
+	}
+	for _, tc := range tests {
+		f := newTestFetcher(func(req *http.Request) (*http.Response, error) {
+			return fakeResponse(req, 200, tc.contentType, tc.body), nil
+		})
+		withFetcher(t, f)
+		sct, err := webnotes.NewSection("", tc.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := sct.Get()
+		if err != nil {
+			t.Fatalf("%s: unexpected get failure: %s", tc.url, err)
+		}
+		if title := webnotes.ContentTitle(doc); title != tc.title {
+			t.Fatalf("%s: unexpected title: %s", tc.url, title)
+		}
+		if p := webnotes.ContentP(doc); !reflect.DeepEqual(p, tc.p) {
+			t.Fatalf("%s: unexpected p content: %q", tc.url, p)
+		}
+		for name, value := range tc.fields {
+			if !sct.FieldEqualsValue(name, value) {
+				t.Fatalf("%s: unexpected section content: %s", tc.url, sct)
+			}
+		}
+	}
+}
+
+func TestFetcherRobotsTxt(t *testing.T) {
+	robots := "User-agent: *\nDisallow: /\n\nUser-agent: webnotes\nDisallow: /private\nAllow: /private/ok$\n"
+	f := newTestFetcher(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/robots.txt" {
+			return fakeResponse(req, 200, "text/plain", robots), nil
+		}
+		return fakeResponse(req, 200, "text/html", "<html></html>"), nil
+	})
+	f.RobotsTxt = true
+	f.OwnHosts = []string{"mine.example.com"}
+	type test struct {
+		url     string
+		allowed bool
+	}
+	tests := []test{
+		{"https://example.com/public", true},
+		{"https://example.com/private/page", false},
+		{"https://example.com/private/ok", true},
+		{"https://mine.example.com/private/page", true},
+	}
+	for _, tc := range tests {
+		_, _, err := f.Get(tc.url)
+		if tc.allowed && err != nil {
+			t.Fatalf("%s: unexpected get failure: %s", tc.url, err)
+		}
+		if !tc.allowed && !errors.Is(err, webnotes.ErrDisallowed) {
+			t.Fatalf("%s: expected disallowed error but got: %v", tc.url, err)
+		}
+	}
+}
+
+func TestFetcherRobotsTxtFetch(t *testing.T) {
+	robotsRequests := map[string]int{}
+	f := newTestFetcher(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/robots.txt" {
+			robotsRequests[req.URL.Host]++
+			if req.URL.Host == "down.example.com" {
+				return nil, errors.New("connection refused")
+			}
+			return fakeResponse(req, 200, "text/plain", "User-agent: *\nDisallow: /private\n"), nil
+		}
+		return fakeResponse(req, 200, "text/html", "<html></html>"), nil
+	})
+	f.RobotsTxt = true
+	f.Cache = webnotes.NewHTTPCache(t.TempDir(), time.Hour)
+	warcDir := t.TempDir()
+	ww, err := webnotes.NewWARCWriter(warcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ww.Close()
+	f.WARC = ww
+	// a robots.txt that can not be fetched is only tried once
+	for _, path := range []string{"/a", "/b"} {
+		if _, _, err := f.Get("https://down.example.com" + path); err == nil || !strings.Contains(err.Error(), "connection refused") {
+			t.Fatalf("%s: expected robots.txt failure but got: %v", path, err)
+		}
+	}
+	if _, _, err := f.Get("https://example.com/page"); err != nil {
+		t.Fatalf("unexpected get failure: %s", err)
+	}
+	if _, _, err := f.Get("https://example.com/private"); !errors.Is(err, webnotes.ErrDisallowed) {
+		t.Fatalf("expected disallowed error but got: %v", err)
+	}
+	if !reflect.DeepEqual(robotsRequests, map[string]int{"down.example.com": 1, "example.com": 1}) {
+		t.Fatalf("unexpected robots.txt requests: %v", robotsRequests)
+	}
+	// robots.txt is not cached or archived like the pages are
+	if resp, _, _, err := f.Cache.Load("https://example.com/robots.txt"); err != nil || resp != nil {
+		t.Fatalf("robots.txt was cached: %v", err)
+	}
+	if resp, _, _, err := f.Cache.Load("https://example.com/page"); err != nil || resp == nil {
+		t.Fatalf("page was not cached: %v", err)
+	}
+	index, err := webnotes.LoadWARCIndex(warcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 1 || index[0].URL != "https://example.com/page" {
+		t.Fatalf("unexpected WARC index: %v", index)
+	}
+}
+
+func TestParseRobotsTxt(t *testing.T) {
+	robots := "User-agent: *\nDisallow: /all\n\nUser-agent: a\nDisallow: /a\n\n" +
+		"User-agent: GoogleBot\nDisallow: /google\n\nUser-agent: googlebot-news\nDisallow: /news\n"
+	type test struct {
+		userAgent string
+		disallow  []string
+	}
+	tests := []test{
+		{"", []string{"/all"}},
+		{"   ", []string{"/all"}},
+		{"/1.0", []string{"/all"}},
+		{"a/1.0", []string{"/a"}},
+		// a is not a prefix of the product token up to a - or _
+		{"ahrefsbot/7.0", []string{"/all"}},
+		{"webnotes-a/1.0", []string{"/all"}},
+		{"Googlebot/2.1", []string{"/google"}},
+		{"googlebot-image/1.0", []string{"/google"}},
+		{"Googlebot-News", []string{"/news"}},
+	}
+	for _, tc := range tests {
+		rules := webnotes.ParseRobotsTxt(robots, tc.userAgent)
+		if !reflect.DeepEqual(rules.Disallow, tc.disallow) {
+			t.Fatalf("%q: unexpected rules: %v", tc.userAgent, rules.Disallow)
+		}
+	}
+}
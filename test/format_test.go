@@ -0,0 +1,134 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/greglange/webnotes/pkg/webnotes"
+)
+
+func TestFormatRoundTrip(t *testing.T) {
+	values := []string{
+		"plain",
+		"with, comma",
+		"with \"quotes\"",
+		"\"starts with quote",
+		"back\\slash",
+		"two\nlines",
+		"blank\n\nline",
+		" leading and trailing ",
+		"tab\there",
+		"",
+	}
+	filePath := filepath.Join(t.TempDir(), "Test.wn")
+	for _, value := range values {
+		sct, err := webnotes.NewSection("", "https://example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sct.SetFieldValue("title", value)
+		sct.SetFieldValue("description", value)
+		sct.SetFieldValues("keywords", []string{value, "other"})
+		sct.SetFieldValues("custom", []string{"other", value})
+		sct.SetBody([]string{"Some body"})
+		wn := webnotes.NewWebNote(filePath)
+		wn.AddSection(sct)
+		if err := webnotes.SaveWebNote(wn); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := webnotes.LoadWebNote(filePath)
+		if err != nil {
+			t.Fatalf("%q: load web note failure: %s", value, err)
+		}
+		if !reflect.DeepEqual(sct, loaded.Sections[0]) {
+			t.Fatalf("%q: unexpected section content: %#v", value, loaded.Sections[0].Fields)
+		}
+	}
+}
+
+func TestFormatVersion1(t *testing.T) {
+	content := "# https://example.com\ntitle: Some, title\ntags: a,b\n\nSome body\n"
+	filePath := filepath.Join(t.TempDir(), "Test.wn")
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wn, err := webnotes.LoadWebNote(filePath)
+	if err != nil {
+		t.Fatalf("load web note failure: %s", err)
+	}
+	if !wn.Sections[0].FieldEqualsValue("title", "Some, title") {
+		t.Fatalf("unexpected section content: %s", wn.Sections[0])
+	}
+	if err := webnotes.SaveWebNote(wn); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Fatalf("version 1 file changed on save: %s", data)
+	}
+}
+
+func TestFormatVersion1Lists(t *testing.T) {
+	// list values with spaces and empty items need quoting in version 2 but not in version 1
+	content := "# https://example.com/a\ntitle: A\ntags: a,b\nrelated: one, two,,three\n\n# note://b\nkeywords: x, y\n"
+	filePath := filepath.Join(t.TempDir(), "Test.wn")
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wn, err := webnotes.LoadWebNote(filePath)
+	if err != nil {
+		t.Fatalf("load web note failure: %s", err)
+	}
+	if err := webnotes.SaveWebNote(wn); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Fatalf("version 1 file changed on save: %s", data)
+	}
+	// changing one section does not change how the others are written
+	if err := wn.Sections[1].AddTag("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := webnotes.SaveWebNote(wn); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# https://example.com/a\ntitle: A\ntags: a,b\nrelated: one, two,,three\n\n# note://b\ntags: c\nkeywords: x, y\n"
+	if string(data) != expected {
+		t.Fatalf("unexpected file content: %s", data)
+	}
+}
+
+func TestFormatContinuationLines(t *testing.T) {
+	content := "# webnotes format 2\n# https://example.com\ndescription: first line\n second line\nkeywords: \"a,b\",c\n"
+	filePath := filepath.Join(t.TempDir(), "Test.wn")
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wn, err := webnotes.LoadWebNote(filePath)
+	if err != nil {
+		t.Fatalf("load web note failure: %s", err)
+	}
+	if !wn.Sections[0].FieldEqualsValue("description", "first line\nsecond line") {
+		t.Fatalf("unexpected description: %s", wn.Sections[0])
+	}
+	if !wn.Sections[0].FieldHasValues("keywords", []string{"a,b", "c"}) {
+		t.Fatalf("unexpected keywords: %s", wn.Sections[0])
+	}
+	if !strings.HasPrefix(wn.Sections[0].String(), "# https://example.com\ndescription: first line\n second line\n") {
+		t.Fatalf("unexpected section string: %s", wn.Sections[0])
+	}
+}
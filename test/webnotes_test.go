@@ -2,13 +2,22 @@ package test
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/greglange/webnotes/pkg/webnotes"
 )
@@ -48,6 +57,83 @@ func runWebnotes(exitCode int, arg []string) (string, error) {
 	return out.String(), err
 }
 
+// runWebnotesIn runs webnotes in a directory and returns its output.
+// The test fails if webnotes does not exit with exitCode.
+func runWebnotesIn(t *testing.T, dir string, exitCode int, args ...string) string {
+	cmd := exec.Command("webnotes", args...)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Run()
+	if ec := cmd.ProcessState.ExitCode(); ec != exitCode {
+		t.Fatalf("%s: unexpected exit code %d: %s", args, ec, out.String())
+	}
+	return out.String()
+}
+
+// startHttp runs webnotes --http in a directory until the test ends.
+// Returns the url of the server.
+func startHttp(t *testing.T, dir string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	cmd := exec.Command("webnotes", "--http", "--http_address", address)
+	cmd.Dir = dir
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			return "http://" + address
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("webnotes --http did not start listening on %s", address)
+	return ""
+}
+
+// getPage returns the body of a page of a webnotes --http server.
+func getPage(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// postPage posts a form to a webnotes --http page from a page of origin, like a browser, and returns the page it leads to.
+func postPage(t *testing.T, url, origin string, values url.Values) string {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(values.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", origin)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
 func TestNoCammandLineFlags(t *testing.T) {
 	output, err := runWebnotes(1, []string{})
 	if err == nil {
@@ -177,3 +263,1210 @@ func TestAdd(t *testing.T) {
 		}
 	}
 }
+
+func TestAddWARC(t *testing.T) {
+	page := "<html><head><title>Some title</title></head><body><p>Some text</p></body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, page)
+	}))
+	defer srv.Close()
+	warcDir := "test_warc"
+	defer os.RemoveAll(warcDir)
+	defer removeFile("Test.wn")
+	flags := []string{"--add", "--out_file", "Test.wn", "--vurl", srv.URL, "--title", "--warc_dir", warcDir}
+	output, err := runWebnotes(0, flags)
+	if err != nil {
+		t.Fatalf("%s: run webnotes failure: %s", flags, err)
+	}
+	if output != "" {
+		t.Fatalf("%s: unexpected output: %s", flags, output)
+	}
+	wn, err := webnotes.LoadWebNote("Test.wn")
+	if err != nil {
+		t.Fatalf("load web note failure: %s", err)
+	}
+	if !wn.Sections[0].FieldEqualsValue("title", "Some title") {
+		t.Fatalf("unexpected section content: %s", wn.Sections[0])
+	}
+	index, err := webnotes.LoadWARCIndex(warcDir)
+	if err != nil {
+		t.Fatalf("load WARC index failure: %s", err)
+	}
+	entry, ok := webnotes.LatestWARCEntry(index, srv.URL)
+	if !ok {
+		t.Fatalf("url not found in WARC index: %v", index)
+	}
+	resp, err := webnotes.ReadWARCResponse(warcDir, entry)
+	if err != nil {
+		t.Fatalf("read WARC response failure: %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read WARC response body failure: %s", err)
+	}
+	if resp.StatusCode != 200 || string(body) != page {
+		t.Fatalf("unexpected WARC response: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestLint(t *testing.T) {
+	content := "junk\n# https://example.com\ntitle: x\nbad line\ntitle: y\n\nbody\n"
+	if err := os.WriteFile("Lint.wn", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Lint.wn")
+	output, err := runWebnotes(1, []string{"--lint", "--file", "Lint.wn"})
+	if err == nil {
+		t.Fatal("Expected failure")
+	}
+	if _, ok := err.(exitCodeError); ok {
+		t.Fatal(err)
+	}
+	expected := "Lint.wn:1:1: error: Unexpected start to web note file\n" +
+		"Lint.wn:4:1: error: Invalid header line\n" +
+		"Lint.wn:5:1: warning: Duplicate title field\n" +
+		"Found 2 errors\n"
+	if output != expected {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+}
+
+func TestLintRules(t *testing.T) {
+	content := "# note://a\ndate: Jan 2, 2024\nstatus: 404\ncolour: red\n\nsee [b](Lint.wn#b)\n\n" +
+		"# note://a\n\nmore\n\n# https://example.com/\n"
+	if err := os.WriteFile("Lint.wn", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Lint.wn")
+	output, err := runWebnotes(1, []string{"--lint", "--file", "Lint.wn", "--lint_rules", "default,-unknown-field"})
+	if err == nil {
+		t.Fatal("Expected failure")
+	}
+	if _, ok := err.(exitCodeError); ok {
+		t.Fatal(err)
+	}
+	expected := "Lint.wn:2:1: warning: a: date is not YYYY-MM-DD: Jan 2, 2024 [date-format]\n" +
+		"Lint.wn:3:1: warning: a: status field no longer applies [stale-status]\n" +
+		"Lint.wn:6:1: error: a: link to missing note Lint.wn#b [broken-link]\n" +
+		"Lint.wn:8:1: error: a: note is already in the file, which breaks building the index [duplicate-note]\n" +
+		"Found 2 errors\n"
+	if output != expected {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output, err = runWebnotes(1, []string{"--lint", "--fix", "--file", "Lint.wn"})
+	if err == nil {
+		t.Fatal("Expected failure")
+	}
+	expected = "Lint.wn:3:1: warning: a: unknown field colour [unknown-field]\n" +
+		"Lint.wn:5:1: error: a: link to missing note Lint.wn#b [broken-link]\n" +
+		"Found 1 errors\n"
+	if output != expected {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	data, err := os.ReadFile("Lint.wn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "# note://a\ndate: 2024-01-02\ncolour: red\n\nsee [b](Lint.wn#b)\n\nmore\n\n# https://example.com/\n"
+	if string(data) != expected {
+		t.Fatalf("Unexpected file: %s", string(data))
+	}
+}
+
+func TestMatchesLocations(t *testing.T) {
+	content := "# note://a\ntitle: x\n\nbody\n\n# https://example.com/\nkeywords: one,\n two\n"
+	content = "# webnotes format 2\n" + content
+	if err := os.WriteFile("Locations.wn", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Locations.wn")
+	output, err := runWebnotes(0, []string{"--matches", "--locations", "--file", "Locations.wn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Locations.wn:2: a (lines 2-5)\nLocations.wn:7: https://example.com/ (lines 7-9)\n"
+	if output != expected {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	wn, err := webnotes.LoadWebNote("Locations.wn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := wn.SectionLines(wn.Sections[0])
+	if lines.Fields["title"] != (webnotes.Lines{Start: 3, End: 3}) || lines.Body != (webnotes.Lines{Start: 5, End: 5}) {
+		t.Fatalf("Unexpected lines: %v", lines)
+	}
+	lines = wn.SectionLines(wn.Sections[1])
+	if lines.Fields["keywords"] != (webnotes.Lines{Start: 8, End: 9}) || lines.Body != (webnotes.Lines{}) {
+		t.Fatalf("Unexpected lines: %v", lines)
+	}
+}
+
+func TestMatchesFormat(t *testing.T) {
+	content := "# webnotes format 2\n# note://a\ntitle: x\ntags: one,two\n\nbody\n\n# https://example.com/\ntitle: y\n"
+	if err := os.WriteFile("Format1.wn", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Format1.wn")
+	if err := os.WriteFile("Format2.wn", []byte("# https://example.com/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Format2.wn")
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"matches", "--file", "Format1.wn", "--format", "jsonl"},
+			`{"file":"Format1.wn","line":2,"id":"a","note":"a","title":"x","tags":["one","two"],"fields":{"tags":["one","two"],"title":["x"]},"body":"body"}` + "\n" +
+				`{"file":"Format1.wn","line":8,"id":"https://example.com/","url":"https://example.com/","title":"y","fields":{"title":["y"]}}` + "\n"},
+		{[]string{"matches", "--file", "Format1.wn", "--format", "tsv", "--note"},
+			"file\tline\tid\tnote\turl\ttitle\tdescription\tauthor\tdate\ttags\ttype\tstatus\terror\tbody\n" +
+				"Format1.wn\t2\ta\ta\t\tx\t\t\t\tone,two\t\t\t\tbody\n"},
+		{[]string{"--matches", "--file", "Format1.wn", "--template", `{{.ID}}\t{{join .Tags ";"}}`},
+			"a\tone;two\nhttps://example.com/\t\n"},
+		{[]string{"--duplicates", "--format=csv", "--url"},
+			"id,files,locations\nhttps://example.com/,\"Format1.wn,Format2.wn\",\"Format1.wn:8,Format2.wn:1\"\n"},
+	}
+	for _, test := range tests {
+		output, err := runWebnotes(0, test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != test.expected {
+			t.Fatalf("Unexpected output for %v: %s", test.args, output)
+		}
+	}
+	if _, err := runWebnotes(1, []string{"matches", "--format", "xml"}); err == nil {
+		t.Fatal("Expected failure")
+	}
+}
+
+func TestCanonicalURL(t *testing.T) {
+	c := webnotes.NewURLCanonicalizer()
+	tests := []struct {
+		url       string
+		normal    string
+		canonical string
+	}{
+		{"https://example.com", "https://example.com/", "https://example.com"},
+		{"HTTP://WWW.Example.com:80/a/?utm_source=x&id=2&UTM_medium=y#top", "http://www.example.com/a/?id=2",
+			"https://example.com/a?id=2"},
+		{"https://example.com:8443/a?fbclid=1", "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"ftp://example.com/a#b", "ftp://example.com/a#b", "ftp://example.com/a#b"},
+	}
+	for _, test := range tests {
+		if normal := c.Normalize(test.url); normal != test.normal {
+			t.Fatalf("Unexpected normal form of %s: %s", test.url, normal)
+		}
+		if canonical := c.Canonicalize(test.url); canonical != test.canonical {
+			t.Fatalf("Unexpected canonical form of %s: %s", test.url, canonical)
+		}
+	}
+	c.KeepWWW = true
+	c.TrackingParams = []string{"ref"}
+	if canonical := c.Canonicalize("http://www.example.com/?ref=a&utm_source=b"); canonical != "https://www.example.com?utm_source=b" {
+		t.Fatalf("Unexpected canonical form: %s", canonical)
+	}
+}
+
+func TestNormalizeUrls(t *testing.T) {
+	content := "# https://Example.com/a?utm_source=x#top\n\n# http://www.example.com/a/\n\n# https://example.com/b\n"
+	if err := os.WriteFile("Normalize.wn", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Normalize.wn")
+	output, err := runWebnotes(0, []string{"duplicates", "--file", "Normalize.wn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "Normalize.wn,Normalize.wn: https://Example.com/a?utm_source=x#top\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output, err = runWebnotes(0, []string{"normalize_urls", "--file", "Normalize.wn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "Normalize.wn:1: https://Example.com/a?utm_source=x#top -> https://example.com/a\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	if _, err = runWebnotes(0, []string{"combine", "--file", "Normalize.wn"}); err != nil {
+		t.Fatal(err)
+	}
+	wn, err := webnotes.LoadWebNote("Normalize.wn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wn.Sections) != 2 || wn.Sections[0].URL != "https://example.com/a" {
+		t.Fatalf("Unexpected sections: %v", wn.Sections)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	files := map[string]string{
+		"Merge1.wn": "# note://n\ndate: 2024-01-01\n\nfrom 1\n\n# https://example.com/\ntags: x\n",
+		"Merge2.wn": "# note://n\ndate: 2020-01-01\n\nfrom 2\n\n# https://www.example.com\ntags: y,z\n",
+		"Merge3.wn": "# note://links\n\n[n](Merge1.wn#n)\n",
+	}
+	for fp, content := range files {
+		if err := os.WriteFile(fp, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		defer removeFile(fp)
+	}
+	if _, err := runWebnotes(1, []string{"merge", "--home", "newest"}); err == nil {
+		t.Fatal("Expected failure")
+	}
+	output, err := runWebnotes(0, []string{"merge", "--file", "Merge1.wn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output, err = runWebnotes(0, []string{"merge", "--home", "oldest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Merge2.wn:1: n <- Merge1.wn\nMerge1.wn:6: https://example.com/ <- Merge2.wn\nMerge3.wn: 1 links changed\n"
+	if output != expected {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	expectedFiles := map[string]string{
+		"Merge1.wn": "# https://example.com/\ntags: x,y,z\n",
+		"Merge2.wn": "# note://n\ndate: 2020-01-01\n\nfrom 2\n\nfrom 1\n",
+		"Merge3.wn": "# note://links\n\n[n](Merge2.wn#n)\n",
+	}
+	for fp, expected := range expectedFiles {
+		data, err := os.ReadFile(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatalf("Unexpected %s: %s", fp, data)
+		}
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	text := "Type parameters let functions and types work with any type that satisfies a constraint, " +
+		"which removes a lot of duplicated code in libraries."
+	content := "# https://example.com/generics\ntitle: Generics\n\n" + text + "\n\n" +
+		"# https://amp.example.com/generics\ntitle: Generics\n\n" + text + " Read more.\n\n" +
+		"# https://example.com/pasta\ntitle: Pasta\n\nBoil water, add salt and cook the pasta for nine minutes.\n"
+	if err := os.WriteFile("Similar.wn", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Similar.wn")
+	output, err := runWebnotes(0, []string{"similar", "--file", "Similar.wn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "similarity 0.98:\n  Similar.wn:1: https://example.com/generics\n  Similar.wn:6: https://amp.example.com/generics\n"
+	if output != expected {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output, err = runWebnotes(0, []string{"--similar", "--file", "Similar.wn", "--threshold", "0.1", "--template", "{{.Cluster}} {{.ID}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "1 https://example.com/generics\n1 https://amp.example.com/generics\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	if _, err := runWebnotes(1, []string{"similar", "--threshold", "2"}); err == nil {
+		t.Fatal("Expected failure")
+	}
+}
+
+func TestStats(t *testing.T) {
+	content := "# https://example.com/a\nauthor: Ann\ndate: 2023-05-01\ntags: go,web\n\n" +
+		"# https://example.com/b\ndate: 2024-01-02\ntags: go\n\n" +
+		"# https://other.org/c\n"
+	if err := os.WriteFile("Stats.wn", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Stats.wn")
+	output, err := runWebnotes(0, []string{"stats", "--file", "Stats.wn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "sections: 3\nuntagged: 1\nundated: 1\n" +
+		"tags:\n  2 go\n  1 web\n" +
+		"hosts:\n  2 example.com\n  1 other.org\n" +
+		"authors:\n  1 Ann\n" +
+		"files:\n  3 Stats.wn\n" +
+		"years:\n  1 2023\n  1 2024\n" +
+		"tag pairs:\n  1 go + web (overlap 1.00)\n"
+	if output != expected {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output, err = runWebnotes(0, []string{"--stats", "--file", "Stats.wn", "--mtags", "web", "--format=json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []struct {
+		Kind  string `json:"kind"`
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}{}
+	if err := json.Unmarshal([]byte(output), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 10 || records[0].Kind != "sections" || records[0].Count != 1 || records[3].Kind != "tag" || records[3].Name != "go" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output, err = runWebnotes(0, []string{"stats", "--file", "Stats.wn", "--mtags", "web", "--format=csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "kind,name,count,overlap\nsections,,1,\nuntagged,,0,\nundated,,0,\n" +
+		"tag,go,1,\ntag,web,1,\nhost,example.com,1,\nauthor,Ann,1,\nfile,Stats.wn,1,\nyear,2023,1,\n" +
+		"tag_pair,\"go,web\",1,1.00\n"
+	if output != expected {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output, err = runWebnotes(0, []string{"stats", "--file", "Stats.wn", "--template", "{{.Kind}} {{.Count}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(output, "sections 3\nuntagged 1\nundated 1\n") {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	// without = the old form --format is the format command
+	output, err = runWebnotes(2, []string{"--stats", "--file", "Stats.wn", "--format", "json"})
+	if err == nil {
+		t.Fatal("Expected failure")
+	}
+	if !strings.Contains(output, "use --format=json") {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+}
+
+func TestRetag(t *testing.T) {
+	if err := os.WriteFile("Retag1.wn", []byte("# note://a\ntags: golang,web\n\n# note://b\ntags: js,javascript\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Retag1.wn")
+	if err := os.WriteFile("Retag2.wn", []byte("# note://c\ntags: golang\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Retag2.wn")
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"retag", "golang=go"}, "Retag1.wn: 1 sections changed\nRetag2.wn: 1 sections changed\n"},
+		{[]string{"--merge_tags", "js,javascript=javascript", "--file", "Retag1.wn"}, "Retag1.wn: 1 sections changed\n"},
+		{[]string{"--retag", "go=golang", "--file", "Retag2.wn"}, "Retag2.wn: 1 sections changed\n"},
+		{[]string{"retag", "--file", "Retag2.wn", "golang=go"}, "Retag2.wn: 1 sections changed\n"},
+		{[]string{"--untag", "--vtags", "web,unused", "--file", "Retag1.wn"}, "Retag1.wn: 1 sections changed\n"},
+		{[]string{"untag", "--vtags", "unused"}, ""},
+	}
+	for _, test := range tests {
+		output, err := runWebnotes(0, test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != test.expected {
+			t.Fatalf("Unexpected output for %v: %s", test.args, output)
+		}
+	}
+	for _, args := range [][]string{{"retag", "a,b=c"}, {"retag", "a"}, {"merge_tags", "a=b,c"}, {"--retag", "a", "--file", "Retag1.wn"}} {
+		if _, err := runWebnotes(1, args); err == nil {
+			t.Fatalf("Expected failure for %v", args)
+		}
+	}
+	if _, err := runWebnotes(2, []string{"retag", "a=b", "c=d"}); err == nil {
+		t.Fatal("Expected failure")
+	}
+	wn, err := webnotes.LoadWebNote("Retag1.wn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []string{"go", "javascript"} {
+		if tags, _ := wn.Sections[i].FieldValues("tags"); !reflect.DeepEqual(tags, []string{expected}) {
+			t.Fatalf("Unexpected tags: %v", tags)
+		}
+	}
+}
+
+func TestHierarchicalTags(t *testing.T) {
+	root := t.TempDir()
+	content := "# note://a\ntags: lang/go/generics,web\n\n# note://b\ntags: lang/go,lang/rust\n\n# note://c\ntags: lang-x,lang/gopher\n"
+	if err := os.WriteFile(filepath.Join(root, "Tags.wn"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := runWebnotes(0, []string{"matches", "--root", root, "--mtags", "lang/go", "--template", "{{.ID}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "a\nb\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	if _, err = runWebnotes(0, []string{"index", "--root", root}); err != nil {
+		t.Fatal(err)
+	}
+	index, err := webnotes.LoadIndexFile(filepath.Join(root, "wn_index", "tags", "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	counts := []int{}
+	for _, ie := range index {
+		names = append(names, ie.Name)
+		counts = append(counts, ie.Count)
+	}
+	expected := []string{"lang", "lang/go", "lang/go/generics", "lang/gopher", "lang/rust", "lang-x", "web"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Unexpected tags: %v", names)
+	}
+	if !reflect.DeepEqual(counts, []int{3, 2, 1, 1, 1, 1, 1}) {
+		t.Fatalf("Unexpected counts: %v", counts)
+	}
+	// lang has every section, once
+	wn, err := webnotes.LoadWebNote(filepath.Join(root, "wn_index", "tags", index[0].MD5+".wn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wn.Sections) != 3 {
+		t.Fatalf("Unexpected sections: %v", wn.Sections)
+	}
+}
+
+func TestIndexSkipsBrokenFiles(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Good.wn"), []byte("# https://example.com/a\ntags: go\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Broken.wn"), []byte("# https://example.com/b\ntags: rust\nnot a header\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := runWebnotes(0, []string{"index", "--root", root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "Broken.wn:3:1: error: Invalid header line\nSkipped 1 files with errors: Broken.wn\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	index, err := webnotes.LoadIndexFile(filepath.Join(root, "wn_index", "tags", "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 1 || index[0].Name != "go" {
+		t.Fatalf("Unexpected tags index: %v", index)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	content1 := "# note://a\n\nold a\n\n# note://b\n\nold b\n\n# https://example.com/\n\nold c\n"
+	content2 := "# note://d\n\nold d\n"
+	if err := os.WriteFile("Edit1.wn", []byte(content1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Edit1.wn")
+	if err := os.WriteFile("Edit2.wn", []byte(content2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Edit2.wn")
+	// the edited file is kept when it has errors
+	t.Setenv("TMPDIR", t.TempDir())
+	// the edited file has errors so nothing is saved
+	t.Setenv("EDITOR", "sed -i s/^#.note/bad/")
+	if _, err := runWebnotes(1, []string{"--edit", "--note"}); err == nil {
+		t.Fatal("Expected failure")
+	}
+	for fp, expected := range map[string]string{"Edit1.wn": content1, "Edit2.wn": content2} {
+		data, err := os.ReadFile(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatalf("Unexpected %s: %s", fp, string(data))
+		}
+	}
+	// changes note a and d and deletes note b
+	t.Setenv("EDITOR", "sed -i -e s/old/new/ -e /^#.note:..b$/,+2d")
+	output, err := runWebnotes(0, []string{"--edit", "--note"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	expected := map[string]string{
+		"Edit1.wn": "# note://a\n\nnew a\n\n# https://example.com/\n\nold c\n",
+		"Edit2.wn": "# note://d\n\nnew d\n",
+	}
+	for fp, expected := range expected {
+		data, err := os.ReadFile(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatalf("Unexpected %s: %s", fp, string(data))
+		}
+	}
+}
+
+func TestTui(t *testing.T) {
+	if err := os.WriteFile("Tui1.wn", []byte("# note://a\n\nbody a\n\n# https://example.com/\ntitle: Example\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Tui1.wn")
+	if err := os.WriteFile("Tui2.wn", []byte("# note://b\n\nbody b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("Tui2.wn")
+	defer removeFile("Tui3.wn")
+	clear := strings.Repeat("\x7f", 20)
+	keys := "4" +
+		// tag note a
+		"/enote=a\rty,z\r" +
+		// move note b to a new file
+		"/" + clear + "enote=b\rmTui3.wn\r" +
+		// delete the url, answering no and then yes
+		"/" + clear + "murl=example\rdn\rdy\r" +
+		"q"
+	cmd := exec.Command("webnotes", "--tui")
+	cmd.Stdin = strings.NewReader(keys)
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"Tui1.wn": "# note://a\ntags: y,z\n\nbody a\n",
+		"Tui2.wn": "",
+		"Tui3.wn": "# note://b\n\nbody b\n",
+	}
+	for fp, expected := range expected {
+		data, err := os.ReadFile(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatalf("Unexpected %s: %q", fp, string(data))
+		}
+	}
+}
+
+func TestTuiMoveFailure(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Tui.wn"), []byte("# note://a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the directory of the file moved to does not exist, so saving it fails
+	cmd := exec.Command("webnotes", "--tui")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader("4mmissing/Out.wn\rq")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "Tui.wn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "# note://a\n" {
+		t.Fatalf("Unexpected Tui.wn: %q", string(data))
+	}
+}
+
+func TestTuiControlCharacters(t *testing.T) {
+	root := t.TempDir()
+	data := "# note://a\ntitle: evil\x1b]0;pwned\x07\n"
+	if err := os.WriteFile(filepath.Join(root, "Tui.wn"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("webnotes", "--tui")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader("q")
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(output), "\x1b]0;") || strings.Contains(string(output), "\x07") {
+		t.Fatalf("Escape sequence written to the terminal: %q", string(output))
+	}
+	if !strings.Contains(string(output), "evil\uFFFD]0;pwned\uFFFD") {
+		t.Fatalf("Title not shown: %q", string(output))
+	}
+}
+
+func TestConfig(t *testing.T) {
+	root := t.TempDir()
+	config := "root = \"notes\"\nout_file = \"Inbox.wn\"\nindex_path = \"idx\"\ndefault_tags = [\"inbox\"]\n\n[fetch]\ntimeout = \"5s\"\n"
+	if err := os.WriteFile(filepath.Join(root, ".webnotes.toml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "notes", "sub")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// the out file and tags come from the config and are relative to the root
+	runWebnotesIn(t, sub, 0, "--add", "--vnote", "a")
+	runWebnotesIn(t, sub, 0, "--add", "--vnote", "b", "--vtags", "other", "--out_file", "Sub.wn")
+	data, err := os.ReadFile(filepath.Join(root, "notes", "Inbox.wn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "# note://a\ntags: inbox\n" {
+		t.Fatalf("Unexpected Inbox.wn: %s", string(data))
+	}
+	// --out_file is relative to the current directory and --file matches it
+	output := runWebnotesIn(t, sub, 0, "--matches", "--file", "Sub.wn")
+	if output != "# note://b\ntags: other\n\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	// absolute paths are used as they are, they are not relative to the current directory or the root
+	other := filepath.Join(t.TempDir(), "Other.wn")
+	runWebnotesIn(t, sub, 0, "--add", "--vnote", "c", "--out_file", other)
+	data, err = os.ReadFile(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "# note://c\ntags: inbox\n" {
+		t.Fatalf("Unexpected Other.wn: %s", string(data))
+	}
+	runWebnotesIn(t, sub, 0, "--index")
+	if _, err := os.Stat(filepath.Join(root, "notes", "idx", "notes", "index")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".webnotes.toml"), []byte("unknown = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output = runWebnotesIn(t, sub, 1, "--matches")
+	if !strings.Contains(output, "Unknown settings") {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+}
+
+func TestTagVocabulary(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".webnotes.toml": "tag_vocabulary = \"tags.toml\"\n",
+		"tags.toml":      "[tags.javascript]\naliases = [\"js\"]\ndescription = \"JavaScript\"\n\n[tags.\"lang/go\"]\naliases = [\"golang\"]\n",
+		"Vocab.wn":       "# note://a\ntags: js,javascript,web\n\n# note://b\ntags: golang\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// aliases match before they are normalized
+	if output := runWebnotesIn(t, root, 0, "matches", "--mtags", "lang", "--template", "{{.ID}}"); output != "b\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	if output := runWebnotesIn(t, root, 0, "add", "--vnote", "c", "--vtags", "JS,other", "--out_file", "Vocab.wn"); output != "Warning: tags not in the tag vocabulary: other\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	if output := runWebnotesIn(t, root, 0, "normalize_tags"); output != "Vocab.wn: 2 sections changed\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "Vocab.wn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# note://a\ntags: javascript,web\n\n# note://b\ntags: lang/go\n\n# note://c\ntags: javascript,other\n"
+	if string(data) != expected {
+		t.Fatalf("Unexpected Vocab.wn: %s", string(data))
+	}
+	if err := os.WriteFile(filepath.Join(root, ".webnotes.toml"), []byte("tag_vocabulary = \"tags.toml\"\nunknown_tags = \"reject\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if output := runWebnotesIn(t, root, 1, "tag", "--vtags", "unknown"); output != "Tags not in the tag vocabulary: unknown\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	if output := runWebnotesIn(t, root, 1, "retag", "web=unknown"); output != "Tags not in the tag vocabulary: unknown\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	if output := runWebnotesIn(t, root, 1, "merge_tags", "web,other=unknown"); output != "Tags not in the tag vocabulary: unknown\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	cmd := exec.Command("webnotes", "--tui")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader("4tunknown\rq")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(filepath.Join(root, "Vocab.wn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Fatalf("Unexpected Vocab.wn: %s", string(data))
+	}
+}
+
+func TestTagValidation(t *testing.T) {
+	tags, err := webnotes.GetTags(" Go, lang/go ,c++")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, []string{"go", "lang/go", "c++"}) {
+		t.Fatalf("Unexpected tags: %v", tags)
+	}
+	for _, tagsString := range []string{"a,,b", "a b", "lang//go", "/go", "a;b", strings.Repeat("a", webnotes.MaxTagLength+1)} {
+		if _, err := webnotes.GetTags(tagsString); err == nil {
+			t.Fatalf("Expected error for %q", tagsString)
+		}
+	}
+	sct, err := webnotes.NewSection("a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sct.AddTags([]string{"ok", "not ok"}); err == nil || sct.HasField("tags") {
+		t.Fatalf("Expected error and no tags: %v", sct)
+	}
+	if err := sct.SetTags([]string{""}); err == nil {
+		t.Fatal("Expected error")
+	}
+	if _, err := sct.RenameTags([]string{"ok"}, "Not OK"); err == nil {
+		t.Fatal("Expected error")
+	}
+	content := "# note://a\ntags: Go, web,,C Sharp,lang//go/,ok\n"
+	if err := os.WriteFile("CleanTags.wn", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer removeFile("CleanTags.wn")
+	// invalid tags are errors, ParseWebNote still loads them so they can be cleaned
+	_, diagnostics, err := webnotes.ParseWebNote("CleanTags.wn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) != 5 || diagnostics[0].String() != "CleanTags.wn:2:1: error: Invalid tag \"Go\": tags must be lower case" {
+		t.Fatalf("Unexpected diagnostics: %v", diagnostics)
+	}
+	if _, err := webnotes.LoadWebNote("CleanTags.wn"); err == nil {
+		t.Fatal("Expected error")
+	}
+	if _, err := runWebnotes(1, []string{"tag", "--file", "CleanTags.wn", "--vtags", "a,,b"}); err == nil {
+		t.Fatal("Expected failure")
+	}
+	output, err := runWebnotes(0, []string{"clean_tags", "--file", "CleanTags.wn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "a: \"Go\" -> \"go\"\na: \" web\" -> \"web\"\na: \"\" removed\na: \"C Sharp\" -> \"c-sharp\"\n" +
+		"a: \"lang//go/\" -> \"lang/go\"\nCleanTags.wn: 1 sections changed\n"
+	if output != expected {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	data, err := os.ReadFile("CleanTags.wn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "# note://a\ntags: c-sharp,go,lang/go,ok,web\n" {
+		t.Fatalf("Unexpected CleanTags.wn: %s", string(data))
+	}
+	// files with other errors are not changed, saving them would drop the lines that were skipped
+	content = "# note://a\ntags: Go\nnot a header\n"
+	if err := os.WriteFile("CleanTags.wn", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output = runWebnotesIn(t, ".", 1, "clean_tags", "--file", "CleanTags.wn")
+	if output != "CleanTags.wn:2:1: error: Invalid tag \"Go\": tags must be lower case\nCleanTags.wn:3:1: error: Invalid header line\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	data, err = os.ReadFile("CleanTags.wn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Fatalf("Unexpected CleanTags.wn: %s", string(data))
+	}
+}
+
+func TestSuggestTags(t *testing.T) {
+	root := t.TempDir()
+	content := "# https://go.dev/blog/generics\ntitle: An introduction to generics\ntags: go\n\n" +
+		"# https://go.dev/blog/errors\ntitle: Working with errors\ntags: go\n\n" +
+		"# https://rust-lang.org/learn\ntitle: Learn Rust ownership\ntags: rust\n\nSee https://doc.rust-lang.org/book/\n\n" +
+		"# https://example.com/borrow\ntitle: Borrowing and ownership\n\nMore at https://doc.rust-lang.org/book/\n\n" +
+		"# https://go.dev/blog/loopvar\ntitle: Fixing for loops\n"
+	if err := os.WriteFile(filepath.Join(root, "Suggest.wn"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := runWebnotesIn(t, root, 0, "suggest_tags")
+	expected := "Suggest.wn:15: https://example.com/borrow\n  0.75 rust (keywords, links)\n" +
+		"Suggest.wn:20: https://go.dev/blog/loopvar\n  0.67 go (host)\n"
+	if output != expected {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output = runWebnotesIn(t, root, 0, "suggest_tags", "--threshold", "0.7", "--apply")
+	if output != "Suggest.wn: 1 sections changed\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output = runWebnotesIn(t, root, 0, "matches", "--mtags", "rust", "--template", "{{.ID}}")
+	if output != "https://rust-lang.org/learn\nhttps://example.com/borrow\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	runWebnotesIn(t, root, 1, "suggest_tags", "--threshold", "0")
+}
+
+func TestSuggestTagsKeywordOnly(t *testing.T) {
+	root := t.TempDir()
+	// the tag is one of the keywords of note://n, but no section with the tag shares its words, host or links
+	content := "# note://k\ntitle: Cluster setup\ntags: kubernetes\n\n# note://n\ntitle: Notes about kubernetes\n"
+	if err := os.WriteFile(filepath.Join(root, "Keyword.wn"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := runWebnotesIn(t, root, 0, "suggest_tags", "--threshold", "0.1")
+	if output != "Keyword.wn:5: n\n  0.40 kubernetes (keywords)\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output = runWebnotesIn(t, root, 0, "suggest_tags", "--threshold", "0.1", "--format=csv")
+	if output != "file,line,id,tag,confidence,sources\nKeyword.wn,5,n,kubernetes,0.40,keywords\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output = runWebnotesIn(t, root, 0, "suggest_tags", "--threshold", "0.1", "--format=jsonl")
+	if output != "{\"file\":\"Keyword.wn\",\"line\":5,\"id\":\"n\",\"tag\":\"kubernetes\",\"confidence\":0.4,\"sources\":[\"keywords\"]}\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	runWebnotesIn(t, root, 1, "suggest_tags", "--threshold", "0.1", "--format=csv", "--apply")
+	output = runWebnotesIn(t, root, 0, "suggest_tags", "--apply")
+	if output != "" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+}
+
+func TestSubcommands(t *testing.T) {
+	defer removeFile("Sub.wn")
+	output, err := runWebnotes(0, []string{"add", "--out_file", "Sub.wn", "--vnote", "a", "--vtags", "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output, err = runWebnotes(0, []string{"matches", "--file", "Sub.wn", "--etags", "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "# note://a\ntags: x\n\n" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	// flags of other commands are rejected
+	output, err = runWebnotes(2, []string{"tag", "--file", "Sub.wn", "--vtags", "y", "--out_file", "Other.wn"})
+	if err == nil {
+		t.Fatal("Expected failure")
+	}
+	if _, ok := err.(exitCodeError); ok {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(output, "flag provided but not defined: -out_file\nUsage of webnotes tag:\n") {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output, err = runWebnotes(2, []string{"unknown"})
+	if err == nil {
+		t.Fatal("Expected failure")
+	}
+	if !strings.HasPrefix(output, "Unknown command: unknown\n") {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	output, err = runWebnotes(0, []string{"help", "tag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "  --vtags <tags> : value for the tags\n") {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	// the older form still accepts every flag
+	if _, err := runWebnotes(0, []string{"--tag", "--file", "Sub.wn", "--vtags", "y", "--out_file", "Other.wn"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHttpInvalidUrls(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Http.wn"), []byte("# https://example.com/a\ntags: go\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := startHttp(t, root)
+	invalid := "<html><head></head><body>\n<a href=\"/\">main</a> | Invalid url\n</body></html>\n"
+	for _, path := range []string{"/x", "/archive/abc/extra", "/authors/abc/extra", "/hosts/abc/extra", "/tags/abc/extra", "/other/abc"} {
+		if page := getPage(t, server+path); page != invalid {
+			t.Fatalf("Unexpected page for %s: %s", path, page)
+		}
+	}
+}
+
+func TestHttpIndexPages(t *testing.T) {
+	root := t.TempDir()
+	content := "# https://example.com/a\ntags: go,web\n\n# https://example.com/b\ntags: go,rust\n\n" +
+		"# https://example.com/c\ntags: go,rust\n"
+	if err := os.WriteFile(filepath.Join(root, "Index.wn"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runWebnotes(0, []string{"index", "--root", root}); err != nil {
+		t.Fatal(err)
+	}
+	server := startHttp(t, root)
+	// order returns the positions of the names in a page, failing if one is missing
+	order := func(page string, names ...string) []int {
+		positions := []int{}
+		for _, name := range names {
+			i := strings.Index(page, ">"+name+"</a>")
+			if i < 0 {
+				t.Fatalf("Expected %s in page: %s", name, page)
+			}
+			positions = append(positions, i)
+		}
+		return positions
+	}
+	page := getPage(t, server+"/tags?view=list")
+	if p := order(page, "go", "rust", "web"); !(p[0] < p[1] && p[1] < p[2]) {
+		t.Fatalf("Expected tags sorted by name: %s", page)
+	}
+	page = getPage(t, server+"/tags?view=list&sort=count")
+	if p := order(page, "go", "rust", "web"); !(p[0] < p[1] && p[1] < p[2]) {
+		t.Fatalf("Expected tags sorted by count: %s", page)
+	}
+	page = getPage(t, server+"/tags?view=list&sort=count&prefix=w")
+	order(page, "web")
+	if strings.Contains(page, ">go</a>") || strings.Contains(page, ">rust</a>") {
+		t.Fatalf("Expected only tags starting with w: %s", page)
+	}
+	page = getPage(t, server+"/tags?view=cloud")
+	for _, expected := range []string{
+		"title=\"3\" style=\"font-size: 240%\">go</a>",
+		"title=\"1\" style=\"font-size: 80%\">web</a>",
+	} {
+		if !strings.Contains(page, expected) {
+			t.Fatalf("Expected %s in page: %s", expected, page)
+		}
+	}
+	page = getPage(t, server+"/hosts?view=cloud&sort=count")
+	order(page, "example.com")
+	invalid := "<html><head></head><body>\n<a href=\"/\">main</a> | Invalid url\n</body></html>\n"
+	for _, path := range []string{"/tags?sort=size", "/hosts?view=tree", "/tags?view=pie"} {
+		if page := getPage(t, server+path); page != invalid {
+			t.Fatalf("Unexpected page for %s: %s", path, page)
+		}
+	}
+}
+
+func TestHttpStats(t *testing.T) {
+	root := t.TempDir()
+	content := "# https://example.com/a\nauthor: <script>alert(1)</script>\ntags: go,web\n"
+	if err := os.WriteFile(filepath.Join(root, "Stats.wn"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Broken.wn"), []byte("no header line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := startHttp(t, root)
+	page := getPage(t, server+"/stats")
+	for _, expected := range []string{
+		"<p>sections: 1, untagged: 0, undated: 1</p>",
+		"<p>skipped files with errors: Broken.wn</p>",
+		"<td>&lt;script&gt;alert(1)&lt;/script&gt;</td>",
+		"<td>go + web</td>",
+	} {
+		if !strings.Contains(page, expected) {
+			t.Fatalf("Expected %s in page: %s", expected, page)
+		}
+	}
+	if strings.Contains(page, "<script>") {
+		t.Fatalf("Unescaped name in page: %s", page)
+	}
+}
+
+func TestHttpForms(t *testing.T) {
+	root := t.TempDir()
+	content := "# https://rust-lang.org/learn\ntitle: Learn Rust ownership\ntags: rust\n\nSee https://doc.rust-lang.org/book/\n"
+	if err := os.WriteFile(filepath.Join(root, "Forms.wn"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".webnotes.toml"), []byte("out_file = \"Added.wn\"\ndefault_tags = [\"new\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := startHttp(t, root)
+	page := getPage(t, server+"/add")
+	for _, expected := range []string{"<input name=\"file\" value=\"Added.wn\">", "<input name=\"tags\" value=\"new\">"} {
+		if !strings.Contains(page, expected) {
+			t.Fatalf("Expected %s in page: %s", expected, page)
+		}
+	}
+	values := url.Values{"file": {"Added.wn"}, "url": {"https://example.com/borrow"}, "title": {"Borrowing and ownership"},
+		"body": {"More at https://doc.rust-lang.org/book/"}}
+	page = getPage(t, server+"/add?"+values.Encode())
+	if !strings.Contains(page, ">rust</a> 0.75 (keywords, links)</p>") {
+		t.Fatalf("Expected rust to be suggested: %s", page)
+	}
+	values.Set("tags", "rust")
+	page = postPage(t, server+"/add", server, values)
+	if !strings.Contains(page, "<a href=\"https://example.com/borrow\">https://example.com/borrow</a> (<a href=\"/edit?") {
+		t.Fatalf("Expected the added webnote with an edit link: %s", page)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "Added.wn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# https://example.com/borrow\ntitle: Borrowing and ownership\ntags: rust\n\nMore at https://doc.rust-lang.org/book/\n"
+	if string(data) != expected {
+		t.Fatalf("Unexpected file: %s", data)
+	}
+	edit := url.Values{"file": {"Added.wn"}, "id": {"https://example.com/borrow"}}
+	page = getPage(t, server+"/edit?"+edit.Encode())
+	for _, expected := range []string{"<input name=\"title\" value=\"Borrowing and ownership\">", "<input name=\"tags\" value=\"rust\">"} {
+		if !strings.Contains(page, expected) {
+			t.Fatalf("Expected %s in page: %s", expected, page)
+		}
+	}
+	edit.Set("title", "Borrowing")
+	edit.Set("tags", "rust,memory")
+	edit.Set("body", "")
+	postPage(t, server+"/edit", server, edit)
+	data, err = os.ReadFile(filepath.Join(root, "Added.wn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "# https://example.com/borrow\ntitle: Borrowing\ntags: memory,rust\n" {
+		t.Fatalf("Unexpected file: %s", data)
+	}
+	// files outside the workspace can not be changed
+	page = postPage(t, server+"/add", server, url.Values{"file": {"../Outside.wn"}, "note": {"a"}})
+	if !strings.Contains(page, "Invalid file: ../Outside.wn") {
+		t.Fatalf("Unexpected page: %s", page)
+	}
+	// forms posted from other sites are not saved
+	edit.Set("title", "Changed")
+	for _, origin := range []string{"https://example.com", ""} {
+		page = postPage(t, server+"/edit", origin, edit)
+		if !strings.Contains(page, "Forms can only be posted from the pages of this webserver") {
+			t.Fatalf("Unexpected page: %s", page)
+		}
+		page = postPage(t, server+"/add", origin, url.Values{"file": {"Added.wn"}, "note": {"b"}})
+		if !strings.Contains(page, "Forms can only be posted from the pages of this webserver") {
+			t.Fatalf("Unexpected page: %s", page)
+		}
+	}
+	data, err = os.ReadFile(filepath.Join(root, "Added.wn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "# https://example.com/borrow\ntitle: Borrowing\ntags: memory,rust\n" {
+		t.Fatalf("Unexpected file: %s", data)
+	}
+	page = getPage(t, server+"/edit?file=Added.wn&id=missing")
+	if !strings.Contains(page, "Webnote not found: missing in Added.wn") {
+		t.Fatalf("Unexpected page: %s", page)
+	}
+}
+
+func TestHttpArchive(t *testing.T) {
+	page := "<html><head><script>alert(1)</script></head><body>archived</body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, page)
+	}))
+	defer srv.Close()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Archive.wn"), []byte("# "+srv.URL+"/page\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runWebnotesIn(t, root, 0, "archive")
+	server := startHttp(t, root)
+	resp, err := http.Get(fmt.Sprintf("%s/archive/%x", server, md5.Sum([]byte(srv.URL+"/page"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != page {
+		t.Fatalf("Unexpected page: %s", body)
+	}
+	if csp := resp.Header.Get("Content-Security-Policy"); csp != "sandbox" {
+		t.Fatalf("Unexpected Content-Security-Policy: %s", csp)
+	}
+	if nosniff := resp.Header.Get("X-Content-Type-Options"); nosniff != "nosniff" {
+		t.Fatalf("Unexpected X-Content-Type-Options: %s", nosniff)
+	}
+}
+
+func TestArchiveCache(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/page" {
+			requests++
+		}
+		if r.Header.Get("If-None-Match") == "\"v1\"" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", "\"v1\"")
+		fmt.Fprint(w, "<html><body>cached</body></html>")
+	}))
+	defer srv.Close()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Archive.wn"), []byte("# "+srv.URL+"/page\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the first fetch fills the cache, the others archive the cached page, the last after revalidating it
+	runWebnotesIn(t, root, 0, "archive", "--cache_dir", "cache")
+	runWebnotesIn(t, root, 0, "archive", "--cache_dir", "cache")
+	runWebnotesIn(t, root, 0, "archive", "--cache_dir", "cache", "--cache_only")
+	runWebnotesIn(t, root, 0, "archive", "--cache_dir", "cache", "--cache_ttl", "0s")
+	if requests != 2 {
+		t.Fatalf("Unexpected number of requests: %d", requests)
+	}
+	index, err := webnotes.LoadWARCIndex(filepath.Join(root, webnotes.WARCPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived := 0
+	for _, entry := range index {
+		if entry.URL != srv.URL+"/page" {
+			continue
+		}
+		archived++
+		resp, err := webnotes.ReadWARCResponse(filepath.Join(root, webnotes.WARCPath), entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "<html><body>cached</body></html>" {
+			t.Fatalf("Unexpected WARC response: %s", body)
+		}
+	}
+	if archived != 4 {
+		t.Fatalf("Unexpected number of archived responses: %d", archived)
+	}
+}
+
+func TestArchiveFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	defer srv.Close()
+	root := t.TempDir()
+	content := "# " + srv.URL + "/page\n\n# " + srv.URL + "/missing\n\n# http://127.0.0.1:1/refused\n"
+	if err := os.WriteFile(filepath.Join(root, "Archive.wn"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := runWebnotesIn(t, root, 1, "archive")
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "Archive.wn:3: "+srv.URL+"/missing: 404 Not Found" ||
+		!strings.HasPrefix(lines[1], "Archive.wn:5: http://127.0.0.1:1/refused: ") || lines[2] != "Failed to archive 2 urls" {
+		t.Fatalf("Unexpected output: %s", output)
+	}
+	// archiving does not change the webnotes
+	data, err := os.ReadFile(filepath.Join(root, "Archive.wn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Fatalf("Unexpected file: %s", data)
+	}
+}